@@ -4,14 +4,21 @@ import (
     "context"
     "log"
     "net/http"
-    "net/url"
     "os"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/brennanromance/heard/internal/db"
     "github.com/brennanromance/heard/internal/handlers"
+    "github.com/brennanromance/heard/internal/mailer"
+    "github.com/brennanromance/heard/internal/oidc"
+    "github.com/brennanromance/heard/internal/password"
     "github.com/brennanromance/heard/internal/repo"
+    "github.com/brennanromance/heard/internal/throttle"
     _ "github.com/jackc/pgx/v5/stdlib"
     "github.com/joho/godotenv"
+    "golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -21,21 +28,27 @@ func main() {
         log.Fatalf("Error loading .env file: %v", err)
     }
 
-    dbUser := os.Getenv("DB_USER")
-    dbPassword := os.Getenv("DB_PASSWORD")
-    dbHost := os.Getenv("DB_HOST")
-    dbPort := os.Getenv("DB_PORT")
-    dbName := os.Getenv("DB_NAME")
-
-    if dbUser == "" || dbPassword == "" || dbHost == "" || dbPort == "" || dbName == "" {
-        log.Fatalf("DB_USER, DB_PASSWORD, DB_HOST, or DB_PORT environment variables are not set")
+    dsn, err := db.DSNFromEnv()
+    if err != nil {
+        log.Fatalf("database: %v", err)
     }
 
-    dsn := os.Getenv("DATABASE_URL")
-    if dsn == "" {
-        dsn = "postgres://" + url.QueryEscape(dbUser) + ":" + url.QueryEscape(dbPassword) +
-            "@" + dbHost + ":" + dbPort + "/" + dbName + "?sslmode=disable"
+    keyCfg := handlers.KeyConfig{
+        Algorithm:      os.Getenv("JWT_ALG"),
+        Secret:         os.Getenv("JWT_SECRET"),
+        AllowDevSecret: os.Getenv("JWT_ALLOW_DEV_SECRET") == "true",
+        PrivateKeyFile: os.Getenv("JWT_PRIVATE_KEY_FILE"),
+        KeyID:          os.Getenv("JWT_KEY_ID"),
+        Issuer:         os.Getenv("JWT_ISSUER"),
+    }
+    if v := os.Getenv("JWT_VERIFY_KEYS"); v != "" {
+        keyCfg.VerifyKeyFiles = strings.Split(v, ",")
+    }
+    keySet, err := handlers.LoadKeySet(keyCfg)
+    if err != nil {
+        log.Fatalf("jwt keys: %v", err)
     }
+    handlers.SetKeySet(keySet)
 
     sqlDB, err := db.Connect(context.Background(), dsn)
     if err != nil {
@@ -46,11 +59,141 @@ func main() {
     // repositories
     companyRepo := repo.NewCompanyRepo(sqlDB)
     userRepo := repo.NewUserRepo(sqlDB)
+    if v := os.Getenv("BCRYPT_COST"); v != "" {
+        cost, err := strconv.Atoi(v)
+        if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+            log.Fatalf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+        }
+        userRepo.SetPasswordCost(cost)
+    }
     postRepo := repo.NewPostRepo(sqlDB)
     commentRepo := repo.NewCommentRepo(sqlDB)
+    tokenRepo := repo.NewTokenRepo(sqlDB)
+    affiliationRepo := repo.NewAffiliationRepo(sqlDB)
+    pseudonymRepo := repo.NewPseudonymRepo(sqlDB)
+    roleRepo := repo.NewRoleRepo(sqlDB)
+    userTokenRepo := repo.NewUserTokenRepo(sqlDB)
+    mfaRepo := repo.NewMFARepo(sqlDB)
+    erasureRepo := repo.NewErasureRepo(sqlDB)
+    identityRepo := repo.NewIdentityRepo(sqlDB)
+    apiKeyRepo := repo.NewAPIKeyRepo(sqlDB)
+    reviewRepo := repo.NewReviewRepo(sqlDB)
+    compensationRepo := repo.NewCompensationRepo(sqlDB)
+    interviewRepo := repo.NewInterviewRepo(sqlDB)
+    followRepo := repo.NewFollowRepo(sqlDB)
+
+    // periodically drop expired refresh tokens and revocation entries
+    go func() {
+        for range time.Tick(time.Hour) {
+            if err := tokenRepo.PurgeExpired(context.Background()); err != nil {
+                log.Printf("purge expired tokens: %v", err)
+            }
+            if err := identityRepo.PurgeExpiredLoginStates(context.Background()); err != nil {
+                log.Printf("purge expired login states: %v", err)
+            }
+        }
+    }()
+
+    // erase accounts queued through DELETE /me
+    go func() {
+        for range time.Tick(30 * time.Second) {
+            if n, err := erasureRepo.ProcessPending(context.Background()); err != nil {
+                log.Printf("account erasure: %v", err)
+            } else if n > 0 {
+                log.Printf("erased %d account(s)", n)
+            }
+        }
+    }()
+
+    // outgoing mail
+    mailFrom := os.Getenv("MAIL_FROM")
+    if mailFrom == "" {
+        mailFrom = "Heard <no-reply@heard.local>"
+    }
+    var m mailer.Mailer
+    switch os.Getenv("MAIL_DRIVER") {
+    case "smtp":
+        m = mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+    case "memory":
+        m = mailer.NewMemoryMailer()
+    case "", "file":
+        mailDir := os.Getenv("MAIL_DIR")
+        if mailDir == "" {
+            mailDir = "mail"
+        }
+        m = mailer.NewFileMailer(mailDir, mailFrom)
+    default:
+        log.Fatalf("unknown MAIL_DRIVER %q", os.Getenv("MAIL_DRIVER"))
+    }
 
     // handlers
-    h := handlers.NewHandler(companyRepo, userRepo, postRepo, commentRepo)
+    h := handlers.NewHandler(companyRepo, userRepo, postRepo, commentRepo, tokenRepo, affiliationRepo, pseudonymRepo, roleRepo, userTokenRepo, mfaRepo, erasureRepo, identityRepo, apiKeyRepo, reviewRepo, compensationRepo, interviewRepo, followRepo, m)
+    h.SetAppURL(os.Getenv("APP_URL"))
+    h.SetTrustProxyHeaders(os.Getenv("TRUST_PROXY_HEADERS") == "true")
+
+    // password policy
+    policy := password.DefaultPolicy()
+    if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+        if policy.MinLength, err = strconv.Atoi(v); err != nil {
+            log.Fatalf("PASSWORD_MIN_LENGTH: %v", err)
+        }
+    }
+    if v := os.Getenv("PASSWORD_MIN_ENTROPY"); v != "" {
+        if policy.MinEntropyBits, err = strconv.ParseFloat(v, 64); err != nil {
+            log.Fatalf("PASSWORD_MIN_ENTROPY: %v", err)
+        }
+    }
+    if v := os.Getenv("PASSWORD_BREACHED_LIST"); v != "" {
+        if policy.Breached, err = password.OpenBreachedList(v); err != nil {
+            log.Fatalf("PASSWORD_BREACHED_LIST: %v", err)
+        }
+    }
+    h.SetPasswordPolicy(policy)
+    if v := os.Getenv("COMPENSATION_MIN_USERS"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < repo.CompensationMinUsers {
+            log.Fatalf("COMPENSATION_MIN_USERS must be an integer of at least %d", repo.CompensationMinUsers)
+        }
+        h.SetCompensationMinUsers(n)
+    }
+    switch os.Getenv("LOGIN_THROTTLE_STORE") {
+    case "postgres":
+        store := throttle.NewPostgresStore(sqlDB)
+        h.SetLoginThrottleStore(store)
+        go func() {
+            for range time.Tick(time.Hour) {
+                if err := store.Prune(context.Background(), 24*time.Hour); err != nil {
+                    log.Printf("prune login attempts: %v", err)
+                }
+            }
+        }()
+    case "", "memory":
+    default:
+        log.Fatalf("unknown LOGIN_THROTTLE_STORE %q", os.Getenv("LOGIN_THROTTLE_STORE"))
+    }
+
+    // "Sign in with" providers, e.g. OIDC_PROVIDERS=google reads OIDC_GOOGLE_*
+    for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+        name = strings.TrimSpace(name)
+        if name == "" {
+            continue
+        }
+        prefix := "OIDC_" + strings.ToUpper(name) + "_"
+        cfg := oidc.Config{
+            Name:         strings.ToLower(name),
+            Issuer:       os.Getenv(prefix + "ISSUER"),
+            ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+            ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+            RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+        }
+        if v := os.Getenv(prefix + "SCOPES"); v != "" {
+            cfg.Scopes = strings.Fields(v)
+        }
+        if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+            log.Fatalf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL must be set", prefix, prefix, prefix)
+        }
+        h.AddOIDCProvider(oidc.NewProvider(cfg, nil))
+    }
 
     mux := http.NewServeMux()
     h.RegisterRoutes(mux)
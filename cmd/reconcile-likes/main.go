@@ -0,0 +1,40 @@
+// Command reconcile-likes recomputes post.likes and comment.likes from the
+// post_likes and comment_likes tables. The counters are kept current by
+// database triggers; run this after restoring a backup or editing the likes
+// tables by hand. New likes wait while it runs.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/brennanromance/heard/internal/db"
+	"github.com/brennanromance/heard/internal/repo"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// .env is optional here; the environment may already be set
+	_ = godotenv.Load()
+
+	dsn, err := db.DSNFromEnv()
+	if err != nil {
+		log.Fatalf("database: %v", err)
+	}
+	ctx := context.Background()
+	sqlDB, err := db.Connect(ctx, dsn)
+	if err != nil {
+		log.Fatalf("db connect: %v", err)
+	}
+	defer sqlDB.Close()
+
+	posts, err := repo.NewPostRepo(sqlDB).ReconcileLikes(ctx)
+	if err != nil {
+		log.Fatalf("reconcile post likes: %v", err)
+	}
+	comments, err := repo.NewCommentRepo(sqlDB).ReconcileLikes(ctx)
+	if err != nil {
+		log.Fatalf("reconcile comment likes: %v", err)
+	}
+	log.Printf("corrected like counts on %d posts and %d comments", posts, comments)
+}
@@ -1,4 +1,26 @@
 -- Drop existing tables if they exist
+DROP TABLE IF EXISTS company_follow;
+DROP TABLE IF EXISTS company_ticker;
+DROP TABLE IF EXISTS company_alias;
+DROP TABLE IF EXISTS interview;
+DROP TABLE IF EXISTS compensation;
+DROP TABLE IF EXISTS company_review;
+DROP TABLE IF EXISTS api_key;
+DROP TABLE IF EXISTS oidc_login_state;
+DROP TABLE IF EXISTS user_identity;
+DROP TABLE IF EXISTS erasure_request;
+DROP TABLE IF EXISTS mfa_recovery_code;
+DROP TABLE IF EXISTS login_attempt;
+DROP TABLE IF EXISTS user_token;
+DROP TABLE IF EXISTS company_role;
+DROP TABLE IF EXISTS deanonymization_log;
+DROP TABLE IF EXISTS pseudonym;
+DROP TABLE IF EXISTS user_company_affiliation;
+DROP TABLE IF EXISTS affiliation_challenge;
+DROP TABLE IF EXISTS company_domain;
+DROP TABLE IF EXISTS revoked_token;
+DROP TABLE IF EXISTS refresh_token;
+DROP TABLE IF EXISTS auth_session;
 DROP TABLE IF EXISTS post_likes;
 DROP TABLE IF EXISTS comment_likes;
 DROP TABLE IF EXISTS comment;
@@ -6,12 +28,30 @@ DROP TABLE IF EXISTS post;
 DROP TABLE IF EXISTS company;
 DROP TABLE IF EXISTS users;
 
+-- Extensions
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- unaccent() is only STABLE; this wrapper pins the dictionary so it can be
+-- used in indexes
+CREATE OR REPLACE FUNCTION immutable_unaccent(text)
+RETURNS text AS $$
+    SELECT public.unaccent('public.unaccent', $1)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
 -- Create tables
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(50) NOT NULL UNIQUE,
     email VARCHAR(255) NOT NULL UNIQUE,
-    password VARCHAR(255) NOT NULL
+    password VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    email_verified BOOLEAN NOT NULL DEFAULT false,
+    totp_secret TEXT,
+    totp_enabled BOOLEAN NOT NULL DEFAULT false,
+    totp_last_counter BIGINT,
+    deleted_at TIMESTAMPTZ,
+    service_account BOOLEAN NOT NULL DEFAULT false
 );
 
 CREATE TABLE company (
@@ -26,6 +66,16 @@ CREATE TABLE company (
     user_id INTEGER REFERENCES users(id) ON DELETE SET NULL
     );
 
+-- Case- and accent-insensitive name search (prefix matches use the index)
+CREATE INDEX company_name_search_idx ON company (lower(immutable_unaccent(name)) text_pattern_ops);
+CREATE INDEX company_industry_idx ON company (lower(industry), lower(sub_industry));
+-- Keyset pagination orders
+CREATE INDEX company_name_sort_idx ON company (lower(immutable_unaccent(name)), id);
+-- Walking the corporate hierarchy downwards
+CREATE INDEX company_parent_company_id_idx ON company (parent_company_id);
+-- Fuzzy name matching (pg_trgm similarity)
+CREATE INDEX company_name_trgm_idx ON company USING gin (lower(immutable_unaccent(name)) gin_trgm_ops);
+
 CREATE TABLE post (
     id SERIAL PRIMARY KEY,
     title VARCHAR(255) NOT NULL,
@@ -33,20 +83,37 @@ CREATE TABLE post (
     company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE SET NULL,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     likes INTEGER NOT NULL DEFAULT 0,
+    anonymous BOOLEAN NOT NULL DEFAULT false,
     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- Full-text search document; title matches outrank description matches
+    search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED
 );
 
+CREATE INDEX post_created_at_idx ON post (created_at, id);
+CREATE INDEX post_company_id_idx ON post (company_id, created_at, id);
+CREATE INDEX post_search_idx ON post USING gin (search);
+
 CREATE TABLE comment (
     id SERIAL PRIMARY KEY,
     message TEXT NOT NULL,
     post_id INTEGER NOT NULL REFERENCES post(id) ON DELETE CASCADE,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     likes INTEGER NOT NULL DEFAULT 0,
+    anonymous BOOLEAN NOT NULL DEFAULT false,
     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- Full-text search document, weighted below both parts of a post
+    search TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('english', message), 'C')) STORED
 );
 
+CREATE INDEX comment_created_at_idx ON comment (created_at, id);
+CREATE INDEX comment_post_id_idx ON comment (post_id);
+CREATE INDEX comment_search_idx ON comment USING gin (search);
+
 -- Likes join tables
 CREATE TABLE post_likes (
     id SERIAL PRIMARY KEY,
@@ -56,6 +123,8 @@ CREATE TABLE post_likes (
     UNIQUE(user_id, post_id)
 );
 
+CREATE INDEX post_likes_post_id_idx ON post_likes(post_id);
+
 CREATE TABLE comment_likes (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -64,6 +133,295 @@ CREATE TABLE comment_likes (
     UNIQUE(user_id, comment_id)
 );
 
+CREATE INDEX comment_likes_comment_id_idx ON comment_likes(comment_id);
+
+-- Failed login tracking shared by all API instances (keys like "account:<email>", "ip:<addr>")
+CREATE TABLE login_attempt (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ
+);
+
+-- Hashed single-use recovery codes for users with two-factor authentication
+CREATE TABLE mfa_recovery_code (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX mfa_recovery_code_user_id_idx ON mfa_recovery_code(user_id);
+
+-- Single-use tokens mailed to users (email verification, password reset)
+CREATE TABLE user_token (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(50) NOT NULL CHECK (purpose IN ('email_verification', 'password_reset')),
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Auth sessions: one row per login, shared by every refresh token rotated from it
+CREATE TABLE auth_session (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT,
+    ip VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX auth_session_user_id_idx ON auth_session(user_id);
+
+CREATE TABLE refresh_token (
+    id SERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES auth_session(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refresh_token_session_id_idx ON refresh_token(session_id);
+
+-- Access tokens revoked before their natural expiry (keyed by JWT "jti")
+CREATE TABLE revoked_token (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Roles scoped to a single company (site-wide roles live in users.role)
+CREATE TABLE company_role (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('company_admin')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(user_id, company_id, role)
+);
+
+-- Work email domains that prove employment at a company. A domain only counts
+-- once verified_at is set, which takes a DNS TXT record carrying
+-- verification_token; several companies may claim a domain, one may prove it.
+CREATE TABLE company_domain (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    domain VARCHAR(255) NOT NULL,
+    verification_token TEXT NOT NULL,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (company_id, domain)
+);
+
+CREATE UNIQUE INDEX company_domain_verified_idx ON company_domain (domain) WHERE verified_at IS NOT NULL;
+
+-- One-time codes mailed to a work address while it is being confirmed
+CREATE TABLE affiliation_challenge (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE user_company_affiliation (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    verified_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(user_id, company_id)
+);
+
+-- Stable per-company display names for anonymous posts and comments
+CREATE TABLE pseudonym (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(user_id, company_id),
+    UNIQUE(company_id, name)
+);
+
+-- Audit trail of moderators revealing the author behind anonymous content
+CREATE TABLE deanonymization_log (
+    id SERIAL PRIMARY KEY,
+    moderator_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    target_type VARCHAR(20) NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Personal access tokens and service-account keys (only the SHA-256 of the key is stored)
+CREATE TABLE api_key (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_key_user_id_idx ON api_key(user_id);
+
+-- External OpenID Connect identities linked to Heard accounts
+CREATE TABLE user_identity (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject TEXT NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(provider, subject)
+);
+
+CREATE INDEX user_identity_user_id_idx ON user_identity(user_id);
+
+-- In-flight OpenID Connect sign-ins (state is stored hashed)
+CREATE TABLE oidc_login_state (
+    state_hash TEXT PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Asynchronous account erasure jobs (see ErasureRepo.ProcessPending)
+CREATE TABLE erasure_request (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    error TEXT,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX erasure_request_active_idx ON erasure_request(user_id) WHERE status IN ('pending', 'running');
+
+-- Structured reviews, shown under the author's pseudonym for the company.
+-- Scores are 1-5; sub-scores are optional. One review per user, company and
+-- calendar year (UTC).
+CREATE TABLE company_review (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    review_year INTEGER NOT NULL DEFAULT EXTRACT(YEAR FROM now() AT TIME ZONE 'UTC'),
+    overall SMALLINT NOT NULL CHECK (overall BETWEEN 1 AND 5),
+    compensation SMALLINT CHECK (compensation BETWEEN 1 AND 5),
+    work_life_balance SMALLINT CHECK (work_life_balance BETWEEN 1 AND 5),
+    management SMALLINT CHECK (management BETWEEN 1 AND 5),
+    culture SMALLINT CHECK (culture BETWEEN 1 AND 5),
+    career_growth SMALLINT CHECK (career_growth BETWEEN 1 AND 5),
+    pros TEXT NOT NULL,
+    cons TEXT NOT NULL,
+    job_title VARCHAR(255),
+    employment_status VARCHAR(20) NOT NULL CHECK (employment_status IN ('current', 'former')),
+    tenure_years INTEGER CHECK (tenure_years >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(company_id, user_id, review_year)
+);
+
+CREATE INDEX company_review_company_id_idx ON company_review(company_id, created_at, id);
+CREATE INDEX company_review_user_id_idx ON company_review(user_id);
+
+-- Self-reported pay. Amounts are yearly and in whole units of currency; only
+-- aggregates over enough distinct users are ever shown to others. One
+-- submission per user, company and calendar year (UTC).
+CREATE TABLE compensation (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    submission_year INTEGER NOT NULL DEFAULT EXTRACT(YEAR FROM now() AT TIME ZONE 'UTC'),
+    title VARCHAR(255) NOT NULL,
+    level VARCHAR(64),
+    location VARCHAR(255),
+    years_experience INTEGER NOT NULL CHECK (years_experience >= 0),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    base_salary INTEGER NOT NULL CHECK (base_salary > 0),
+    bonus INTEGER NOT NULL DEFAULT 0 CHECK (bonus >= 0),
+    equity INTEGER NOT NULL DEFAULT 0 CHECK (equity >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(company_id, user_id, submission_year)
+);
+
+CREATE INDEX compensation_title_idx ON compensation(lower(title));
+CREATE INDEX compensation_user_id_idx ON compensation(user_id);
+
+-- Interview experience reports, shown under the author's pseudonym for the
+-- company. stages is a JSON array of stage names in the order they happened.
+CREATE TABLE interview (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(255) NOT NULL,
+    interview_date DATE NOT NULL,
+    outcome VARCHAR(20) NOT NULL CHECK (outcome IN ('offer', 'reject', 'no_response')),
+    difficulty SMALLINT NOT NULL CHECK (difficulty BETWEEN 1 AND 5),
+    stages JSONB NOT NULL DEFAULT '[]',
+    questions TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX interview_company_id_idx ON interview(company_id, interview_date, id);
+CREATE INDEX interview_user_id_idx ON interview(user_id);
+
+-- Other names a company is known by ("Facebook" for Meta Platforms). Aliases
+-- are unique ignoring case and accents so each resolves to one company.
+CREATE TABLE company_alias (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    alias VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX company_alias_alias_idx ON company_alias (lower(immutable_unaccent(alias)));
+CREATE INDEX company_alias_company_id_idx ON company_alias(company_id);
+CREATE INDEX company_alias_trgm_idx ON company_alias USING gin (lower(immutable_unaccent(alias)) gin_trgm_ops);
+
+-- Stock tickers, stored upper case. A company may list several share classes.
+CREATE TABLE company_ticker (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    symbol VARCHAR(10) NOT NULL UNIQUE,
+    exchange VARCHAR(20),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX company_ticker_company_id_idx ON company_ticker(company_id);
+
+-- Companies a user follows for their feed. include_subsidiaries extends the
+-- follow to every company below it in the hierarchy.
+CREATE TABLE company_follow (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL REFERENCES company(id) ON DELETE CASCADE,
+    include_subsidiaries BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(user_id, company_id)
+);
+
+CREATE INDEX company_follow_company_id_idx ON company_follow(company_id);
+
 -- Trigger function to keep updated_at current on UPDATE
 CREATE OR REPLACE FUNCTION trigger_set_updated_at()
 RETURNS TRIGGER AS $$
@@ -73,16 +431,66 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+-- Posts and comments only count as updated when their content changes, not
+-- when their like counters move
 CREATE TRIGGER post_set_updated_at
-BEFORE UPDATE ON post
+BEFORE UPDATE OF title, description, company_id, user_id, anonymous ON post
 FOR EACH ROW
 EXECUTE FUNCTION trigger_set_updated_at();
 
 CREATE TRIGGER comment_set_updated_at
-BEFORE UPDATE ON comment
+BEFORE UPDATE OF message, post_id, user_id, anonymous ON comment
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_updated_at();
+
+CREATE TRIGGER company_review_set_updated_at
+BEFORE UPDATE ON company_review
 FOR EACH ROW
 EXECUTE FUNCTION trigger_set_updated_at();
 
+CREATE TRIGGER interview_set_updated_at
+BEFORE UPDATE ON interview
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_updated_at();
+
+-- Keep post.likes and comment.likes equal to the rows in the likes join
+-- tables. The counters change in the same transaction as the like, under the
+-- row lock of the post or comment, so concurrent likes never lose an update.
+-- cmd/reconcile-likes recomputes them should they ever drift.
+CREATE OR REPLACE FUNCTION trigger_count_post_likes()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE post SET likes = likes + 1 WHERE id = NEW.post_id;
+    ELSE
+        UPDATE post SET likes = likes - 1 WHERE id = OLD.post_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION trigger_count_comment_likes()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE comment SET likes = likes + 1 WHERE id = NEW.comment_id;
+    ELSE
+        UPDATE comment SET likes = likes - 1 WHERE id = OLD.comment_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_likes_count
+AFTER INSERT OR DELETE ON post_likes
+FOR EACH ROW
+EXECUTE FUNCTION trigger_count_post_likes();
+
+CREATE TRIGGER comment_likes_count
+AFTER INSERT OR DELETE ON comment_likes
+FOR EACH ROW
+EXECUTE FUNCTION trigger_count_comment_likes();
+
 
 INSERT INTO company (name, industry, sub_industry, headquarters, date_incorporated) VALUES
 ('Fox Corporation(Class B)', 'Communication Services', 'Broadcasting', 'New York City, New York', '2019-03-19'),
@@ -187,7 +595,7 @@ INSERT INTO company (name, industry, sub_industry, headquarters, date_incorporat
 ('LyondellBasell', 'Materials', 'Specialty Chemicals', 'Rotterdam, Netherlands', '2012-09-05'),
 ('ExxonMobil', 'Energy', 'Integrated Oil & Gas', 'Irving, Texas', '1957-03-04'),
 ('Evergy', 'Utilities', 'Electric Utilities', 'Kansas City, Missouri', '2018-06-05'),
-('Northrop Grumman', 'Industrials', 'Aerospace & Defense', 'West Falls Church, Virginia[3]', '1957-03-04'),
+('Northrop Grumman', 'Industrials', 'Aerospace & Defense', 'West Falls Church, Virginia', '1957-03-04'),
 ('Ralph Lauren Corporation', 'Consumer Discretionary', 'Apparel, Accessories & Luxury Goods', 'New York City, New York', '2007-02-02'),
 ('Match Group', 'Communication Services', 'Interactive Media & Services', 'Dallas, Texas', '2021-09-20'),
 ('CSX Corporation', 'Industrials', 'Rail Transportation', 'Jacksonville, Florida', '1957-03-04'),
@@ -288,7 +696,7 @@ INSERT INTO company (name, industry, sub_industry, headquarters, date_incorporat
 ('Deere & Company', 'Industrials', 'Agricultural & Farm Machinery', 'Moline, Illinois', '1957-03-04'),
 ('Dayforce', 'Industrials', 'Human Resource & Employment Services', 'Minneapolis, Minnesota', '2021-09-20'),
 ('Monster Beverage', 'Consumer Staples', 'Soft Drinks & Non-alcoholic Beverages', 'Corona, California', '2012-06-28'),
-('Norwegian Cruise Line Holdings', 'Consumer Discretionary', 'Hotels, Resorts & Cruise Lines', 'Miami-Dade County, Florida[4]', '2017-10-13'),
+('Norwegian Cruise Line Holdings', 'Consumer Discretionary', 'Hotels, Resorts & Cruise Lines', 'Miami-Dade County, Florida', '2017-10-13'),
 ('Emerson Electric', 'Industrials', 'Electrical Components & Equipment', 'Ferguson, Missouri', '1965-03-31'),
 ('APA Corporation', 'Energy', 'Oil & Gas Exploration & Production', 'Houston, Texas', '1997-07-28'),
 ('Ingersoll Rand', 'Industrials', 'Industrial Machinery & Supplies & Components', 'Davidson, North Carolina', '2020-03-03'),
@@ -600,3 +1008,23 @@ INSERT INTO company (name, industry, sub_industry, headquarters, date_incorporat
 ('Marathon Petroleum', 'Energy', 'Oil & Gas Refining & Marketing', 'Findlay, Ohio', '2011-07-01'),
 ('Kinder Morgan', 'Energy', 'Oil & Gas Storage & Transportation', 'Houston, Texas', '2012-05-25'),
 ('U.S. Bancorp', 'Financials', 'Diversified Banks', 'Minneapolis, Minnesota', '1999-11-01');
+
+-- Well-known aliases and tickers
+INSERT INTO company_alias (company_id, alias)
+SELECT c.id, v.alias FROM (VALUES
+    ('Meta Platforms', 'Facebook'),
+    ('Meta Platforms', 'Meta'),
+    ('Alphabet Inc.(Class A)', 'Google'),
+    ('Alphabet Inc.(Class A)', 'Alphabet')
+) AS v(company, alias) JOIN company c ON c.name = v.company;
+
+INSERT INTO company_ticker (company_id, symbol, exchange)
+SELECT c.id, v.symbol, v.exchange FROM (VALUES
+    ('Meta Platforms', 'META', 'NASDAQ'),
+    ('Alphabet Inc.(Class A)', 'GOOGL', 'NASDAQ'),
+    ('Alphabet Inc.(Class C)', 'GOOG', 'NASDAQ'),
+    ('Apple Inc.', 'AAPL', 'NASDAQ'),
+    ('Amazon', 'AMZN', 'NASDAQ'),
+    ('Microsoft', 'MSFT', 'NASDAQ'),
+    ('Nvidia', 'NVDA', 'NASDAQ')
+) AS v(company, symbol, exchange) JOIN company c ON c.name = v.company;
@@ -0,0 +1,248 @@
+// Package catalog reads, checks and writes the company catalog as CSV or
+// newline-delimited JSON.
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats understood by Read and NewWriter.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Columns is the CSV header, in export order.
+var Columns = []string{"name", "description", "industry", "sub_industry", "headquarters", "date_incorporated", "parent"}
+
+// Record is one company. Parent names the parent company; empty fields are
+// unset.
+type Record struct {
+	// Line is where the record starts in the input, for error reports.
+	Line int `json:"-"`
+	// Present holds the columns the input supplied for this record, so
+	// importers can leave the others alone.
+	Present          map[string]bool `json:"-"`
+	Name             string          `json:"name"`
+	Description      string          `json:"description,omitempty"`
+	Industry         string          `json:"industry,omitempty"`
+	SubIndustry      string          `json:"sub_industry,omitempty"`
+	Headquarters     string          `json:"headquarters,omitempty"`
+	DateIncorporated string          `json:"date_incorporated,omitempty"`
+	Parent           string          `json:"parent,omitempty"`
+}
+
+// Has reports whether the input supplied column col, even if empty.
+func (rec *Record) Has(col string) bool {
+	return rec.Present[col]
+}
+
+// RowError reports a problem with one input record.
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrUnknownFormat is returned for formats other than csv and ndjson.
+var ErrUnknownFormat = errors.New("format must be csv or ndjson")
+
+// Read parses every record in r. Syntax errors, such as a malformed CSV row or
+// JSON line, abort the read; use Check for per-record validation.
+func Read(r io.Reader, format string) ([]*Record, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatNDJSON:
+		return readNDJSON(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func readCSV(r io.Reader) ([]*Record, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	present := map[string]bool{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !knownColumn(h) {
+			return nil, fmt.Errorf("line 1: unknown column %q", h)
+		}
+		if _, dup := index[h]; dup {
+			return nil, fmt.Errorf("line 1: duplicate column %q", h)
+		}
+		index[h] = i
+		present[h] = true
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, errors.New("line 1: a name column is required")
+	}
+	var out []*Record
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(col string) string {
+			if i, ok := index[col]; ok {
+				return fields[i]
+			}
+			return ""
+		}
+		out = append(out, &Record{
+			Line:             line,
+			Present:          present,
+			Name:             get("name"),
+			Description:      get("description"),
+			Industry:         get("industry"),
+			SubIndustry:      get("sub_industry"),
+			Headquarters:     get("headquarters"),
+			DateIncorporated: get("date_incorporated"),
+			Parent:           get("parent"),
+		})
+	}
+}
+
+func knownColumn(name string) bool {
+	for _, c := range Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readNDJSON(r io.Reader) ([]*Record, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var out []*Record
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(b, &keys); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rec.Present = make(map[string]bool, len(keys))
+		for k := range keys {
+			rec.Present[strings.ToLower(k)] = true
+		}
+		rec.Line = line
+		out = append(out, &rec)
+	}
+	return out, sc.Err()
+}
+
+// Check trims every record in place, collapsing runs of whitespace in names,
+// and reports missing or malformed fields
+// and names that appear more than once. Whether parents exist is left to the
+// importer.
+func Check(recs []*Record) []RowError {
+	var errs []RowError
+	seen := map[string]int{}
+	for _, rec := range recs {
+		for _, f := range []*string{&rec.Description, &rec.Industry, &rec.SubIndustry, &rec.Headquarters, &rec.DateIncorporated} {
+			*f = strings.TrimSpace(*f)
+		}
+		for _, f := range []*string{&rec.Name, &rec.Parent} {
+			*f = strings.Join(strings.Fields(*f), " ")
+		}
+		fail := func(field, code, msg string) {
+			errs = append(errs, RowError{Line: rec.Line, Field: field, Code: code, Message: msg})
+		}
+		if rec.Name == "" {
+			fail("name", "required", "name is required")
+		} else if first, dup := seen[rec.Name]; dup {
+			fail("name", "duplicate", fmt.Sprintf("%q already appears on line %d", rec.Name, first))
+		} else {
+			seen[rec.Name] = rec.Line
+		}
+		for _, f := range []struct{ field, v string }{
+			{"name", rec.Name},
+			{"industry", rec.Industry},
+			{"sub_industry", rec.SubIndustry},
+			{"headquarters", rec.Headquarters},
+			{"parent", rec.Parent},
+		} {
+			if utf8.RuneCountInString(f.v) > 255 {
+				fail(f.field, "too_long", f.field+" must be at most 255 characters")
+			}
+		}
+		if rec.DateIncorporated != "" {
+			if _, err := time.Parse("2006-01-02", rec.DateIncorporated); err != nil {
+				fail("date_incorporated", "invalid", "date_incorporated must be a date in YYYY-MM-DD format")
+			}
+		}
+		if rec.Parent != "" && rec.Parent == rec.Name {
+			fail("parent", "cycle", "a company cannot be its own parent")
+		}
+	}
+	return errs
+}
+
+// Writer streams records in one of the supported formats.
+type Writer struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// NewWriter returns a Writer for format. CSV output starts with the header.
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(Columns); err != nil {
+			return nil, err
+		}
+		return &Writer{csv: cw}, nil
+	case FormatNDJSON:
+		return &Writer{json: json.NewEncoder(w)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+func (w *Writer) Write(rec *Record) error {
+	if w.json != nil {
+		return w.json.Encode(rec)
+	}
+	return w.csv.Write([]string{rec.Name, rec.Description, rec.Industry, rec.SubIndustry, rec.Headquarters, rec.DateIncorporated, rec.Parent})
+}
+
+// Flush writes any buffered output.
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
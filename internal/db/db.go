@@ -3,6 +3,9 @@ package db
 import (
     "context"
     "database/sql"
+    "errors"
+    "net/url"
+    "os"
 
     _ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -19,3 +22,18 @@ func Connect(ctx context.Context, connString string) (*sql.DB, error) {
     }
     return db, nil
 }
+
+// DSNFromEnv returns DATABASE_URL, or builds a connection string from DB_USER,
+// DB_PASSWORD, DB_HOST, DB_PORT and DB_NAME when it is unset.
+func DSNFromEnv() (string, error) {
+    if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+        return dsn, nil
+    }
+    user, password := os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD")
+    host, port, name := os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME")
+    if user == "" || password == "" || host == "" || port == "" || name == "" {
+        return "", errors.New("DATABASE_URL or DB_USER, DB_PASSWORD, DB_HOST, DB_PORT and DB_NAME must be set")
+    }
+    return "postgres://" + url.QueryEscape(user) + ":" + url.QueryEscape(password) +
+        "@" + host + ":" + port + "/" + name + "?sslmode=disable", nil
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/mailer"
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+const affiliationCodeTTL = 15 * time.Minute
+
+type companyDomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+type affiliationRequest struct {
+	Email string `json:"email"`
+}
+
+type affiliationConfirmRequest struct {
+	ChallengeID int    `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+// normalizeDomain lowercases d and rejects values that cannot be a hostname.
+func normalizeDomain(d string) (string, bool) {
+	d = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "@"), ".")
+	if d == "" || !strings.Contains(d, ".") || strings.ContainsAny(d, " @/") {
+		return "", false
+	}
+	return d, true
+}
+
+// domainCandidates returns domain and each of its parent domains, so that
+// "eng.example.com" can match a company registered as "example.com".
+func domainCandidates(domain string) []string {
+	var out []string
+	for {
+		out = append(out, domain)
+		_, rest, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(rest, ".") {
+			return out
+		}
+		domain = rest
+	}
+}
+
+// domainRecordPrefix and domainTokenPrefix make up the TXT record a company
+// publishes to prove it controls a domain.
+const (
+	domainRecordPrefix = "_heard-verification."
+	domainTokenPrefix  = "heard-domain-verification="
+)
+
+// withDNSRecord fills in the TXT record that proves control of d.
+func withDNSRecord(d *models.CompanyDomain) *models.CompanyDomain {
+	d.DNSRecord = &models.DNSRecord{Type: "TXT", Name: domainRecordPrefix + d.Domain, Value: domainTokenPrefix + d.Token}
+	return d
+}
+
+// companyDomainsHandlerGET lists a company's verified domains, and for those
+// who manage the company also its pending claims and their TXT records.
+func (h *Handler) companyDomainsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	list, err := h.affiliations.ListDomains(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	manager := claims.Can(PermManageCompanyDomains, companyResource(existing))
+	out := []*models.CompanyDomain{}
+	for _, d := range list {
+		switch {
+		case manager:
+			out = append(out, withDNSRecord(d))
+		case d.Verified:
+			out = append(out, d)
+		}
+	}
+	writeJSON(w, out, http.StatusOK)
+}
+
+// companyDomainsHandlerPOST claims a domain for a company. The claim only
+// counts once the company publishes the returned TXT record and calls
+// companyDomainVerifyHandler, except for admins, whose claims are verified
+// straight away.
+func (h *Handler) companyDomainsHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	// Get the company to verify access
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	claims, ok := authorize(w, req, PermManageCompanyDomains, companyResource(existing))
+	if !ok {
+		return
+	}
+	var r companyDomainRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	domain, ok := normalizeDomain(r.Domain)
+	if !ok {
+		http.Error(w, "invalid domain", http.StatusBadRequest)
+		return
+	}
+	token, err := randomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d := models.CompanyDomain{CompanyID: id, Domain: domain, Token: token}
+	if claims.Can(PermVerifyCompanyDomains, Resource{}) {
+		now := time.Now()
+		d.VerifiedAt = &now
+	}
+	if err := h.affiliations.AddDomain(ctx, &d); err != nil {
+		if isDuplicateKeyError(err) {
+			http.Error(w, "domain already registered", http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, withDNSRecord(&d), http.StatusCreated)
+}
+
+// companyDomainVerifyHandler looks up the TXT record of a claimed domain and
+// marks the claim verified when it carries the claim's token.
+func (h *Handler) companyDomainVerifyHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	domain, ok := normalizeDomain(req.URL.Query().Get("domain"))
+	if !ok {
+		http.Error(w, "missing domain", http.StatusBadRequest)
+		return
+	}
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := authorize(w, req, PermManageCompanyDomains, companyResource(existing)); !ok {
+		return
+	}
+	d, err := h.affiliations.GetDomain(ctx, id, domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "domain not registered", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !d.Verified {
+		// Lookup errors such as NXDOMAIN just mean the record is not there yet.
+		records, _ := h.lookupTXT(ctx, domainRecordPrefix+d.Domain)
+		found := false
+		for _, r := range records {
+			if strings.TrimSpace(r) == domainTokenPrefix+d.Token {
+				found = true
+			}
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("no TXT record for %s%s carries the verification token", domainRecordPrefix, d.Domain), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := h.affiliations.MarkDomainVerified(ctx, d); err != nil {
+			if isDuplicateKeyError(err) {
+				http.Error(w, "another company has already verified this domain", http.StatusConflict)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	writeJSON(w, withDNSRecord(d), http.StatusOK)
+}
+
+func (h *Handler) companyDomainsHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	domain, ok := normalizeDomain(req.URL.Query().Get("domain"))
+	if !ok {
+		http.Error(w, "missing domain", http.StatusBadRequest)
+		return
+	}
+	// Get the company to verify access
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := authorize(w, req, PermManageCompanyDomains, companyResource(existing)); !ok {
+		return
+	}
+	if err := h.affiliations.DeleteDomain(ctx, id, domain); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// affiliationsHandlerPOST starts verification of a work email by mailing a
+// one-time code to it.
+func (h *Handler) affiliationsHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r affiliationRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	addr, err := mail.ParseAddress(r.Email)
+	if err != nil {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+	at := strings.LastIndex(addr.Address, "@")
+	domain, ok := normalizeDomain(addr.Address[at+1:])
+	if !ok {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+	cd, err := h.affiliations.FindDomain(ctx, domainCandidates(domain))
+	if err != nil {
+		http.Error(w, "no company is registered for this email domain", http.StatusNotFound)
+		return
+	}
+
+	code, err := randomCode(6)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c := models.AffiliationChallenge{
+		UserID:    claims.UserID,
+		CompanyID: cd.CompanyID,
+		Email:     strings.ToLower(addr.Address),
+		ExpiresAt: time.Now().Add(affiliationCodeTTL),
+	}
+	if err := h.affiliations.CreateChallenge(ctx, &c, hashToken(code)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	msg := mailer.Message{
+		To:      c.Email,
+		Subject: "Your Heard verification code",
+		Body:    fmt.Sprintf("Your code to verify your work email on Heard is %s.\nIt expires in %d minutes.\n", code, int(affiliationCodeTTL.Minutes())),
+	}
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		http.Error(w, "failed to send verification email", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"challenge_id": c.ID,
+		"company_id":   c.CompanyID,
+		"expires_at":   c.ExpiresAt,
+	}, http.StatusAccepted)
+}
+
+func (h *Handler) affiliationsConfirmHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r affiliationConfirmRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	a, err := h.affiliations.ConfirmChallenge(ctx, claims.UserID, r.ChallengeID, hashToken(strings.TrimSpace(r.Code)))
+	switch {
+	case errors.Is(err, repo.ErrChallengeNotFound):
+		http.Error(w, "verification challenge not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrChallengeExpired):
+		http.Error(w, "verification code expired", http.StatusGone)
+		return
+	case errors.Is(err, repo.ErrChallengeCode):
+		http.Error(w, "incorrect verification code", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, a, http.StatusCreated)
+}
+
+func (h *Handler) affiliationsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.affiliations.PageForUser(ctx, claims.UserID, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+func (h *Handler) affiliationsHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	companyID, err := strconv.Atoi(req.URL.Query().Get("company_id"))
+	if err != nil {
+		http.Error(w, "missing company_id", http.StatusBadRequest)
+		return
+	}
+	if err := h.affiliations.Delete(ctx, claims.UserID, companyID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// apiKeyPrefix marks API keys so they can be told apart from JWTs and found by
+// secret scanners.
+const apiKeyPrefix = "heard_"
+
+// apiKeyDisplayLen is how much of a key is stored in clear to identify it.
+const apiKeyDisplayLen = len(apiKeyPrefix) + 6
+
+type createAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+	// UserID lets admins mint keys for a service account.
+	UserID int `json:"user_id"`
+}
+
+type serviceAccountRequest struct {
+	Username string `json:"username"`
+}
+
+// apiKeyClaims authenticates an API key and builds claims for its user. The
+// key must carry the scope the matched route requires.
+func (h *Handler) apiKeyClaims(req *http.Request, key string) (*Claims, int, error) {
+	scope, ok := routeScopes[req.Pattern]
+	if !ok {
+		return nil, http.StatusForbidden, errors.New("this endpoint cannot be used with an API key")
+	}
+	ctx := req.Context()
+	k, err := h.apiKeys.Authenticate(ctx, hashToken(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, http.StatusUnauthorized, errors.New("invalid or revoked API key")
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	user, err := h.users.GetByID(ctx, k.UserID)
+	if err != nil {
+		return nil, http.StatusUnauthorized, errors.New("invalid or revoked API key")
+	}
+	roles, err := h.roles.CompanyRolesForUser(ctx, user.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	claims := &Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+		APIKeyID: k.ID,
+		Scopes:   k.Scopes,
+	}
+	for _, cr := range roles {
+		claims.CompanyRoles = append(claims.CompanyRoles, CompanyRoleClaim{CompanyID: cr.CompanyID, Role: cr.Role})
+	}
+	if !claims.HasScope(scope) {
+		return nil, http.StatusForbidden, fmt.Errorf("API key is missing the %q scope", scope)
+	}
+	return claims, 0, nil
+}
+
+// apiKeyOwner returns whose keys a request manages: the caller's own, or with
+// ?user_id= / "user_id" a service account's when the caller is an admin.
+func (h *Handler) apiKeyOwner(w http.ResponseWriter, req *http.Request, requested int) (int, bool) {
+	claims, err := GetUserClaimsFromContext(req.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+	if requested == 0 || requested == claims.UserID {
+		return claims.UserID, true
+	}
+	if !claims.Can(PermManageServiceAccounts, Resource{}) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return 0, false
+	}
+	sa, err := h.users.IsServiceAccount(req.Context(), requested)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !sa) {
+		http.Error(w, "service account not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	return requested, true
+}
+
+func userIDFromQuery(req *http.Request) int {
+	id, _ := strconv.Atoi(req.URL.Query().Get("user_id"))
+	return id
+}
+
+func (h *Handler) apiKeysHandlerGET(w http.ResponseWriter, req *http.Request) {
+	userID, ok := h.apiKeyOwner(w, req, userIDFromQuery(req))
+	if !ok {
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.apiKeys.PageForUser(req.Context(), userID, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+// apiKeysHandlerPOST mints a key. The secret is only ever returned here.
+func (h *Handler) apiKeysHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var r createAPIKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	userID, ok := h.apiKeyOwner(w, req, r.UserID)
+	if !ok {
+		return
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		http.Error(w, "name is required (max 100 characters)", http.StatusBadRequest)
+		return
+	}
+	if len(r.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, s := range r.Scopes {
+		if !knownScopes[Scope(s)] {
+			http.Error(w, fmt.Sprintf("unknown scope %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	if r.ExpiresInDays < 0 {
+		http.Error(w, "expires_in_days must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := apiKeyPrefix + secret
+	k := &models.APIKey{UserID: userID, Name: r.Name, Prefix: key[:apiKeyDisplayLen], Scopes: r.Scopes}
+	if r.ExpiresInDays > 0 {
+		exp := time.Now().Add(time.Duration(r.ExpiresInDays) * 24 * time.Hour)
+		k.ExpiresAt = &exp
+	}
+	if err := h.apiKeys.Create(ctx, k, hashToken(key)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	k.Key = key
+	writeJSON(w, k, http.StatusCreated)
+}
+
+func (h *Handler) apiKeysHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	userID, ok := h.apiKeyOwner(w, req, userIDFromQuery(req))
+	if !ok {
+		return
+	}
+	if err := h.apiKeys.Revoke(req.Context(), userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serviceAccountsHandlerPOST creates a user for automated tooling. It has no
+// usable password; admins mint API keys for it with "user_id". Admin only.
+func (h *Handler) serviceAccountsHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if _, ok := authorize(w, req, PermManageServiceAccounts, Resource{}); !ok {
+		return
+	}
+	var r serviceAccountRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || strings.TrimSpace(r.Username) == "" {
+		http.Error(w, "username is required", http.StatusBadRequest)
+		return
+	}
+	password, err := randomToken(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := &models.User{Username: strings.TrimSpace(r.Username)}
+	user.Email = user.Username + "@service-accounts.heard.invalid"
+	if err := h.users.CreateServiceAccount(ctx, user, password); err != nil {
+		if isDuplicateKeyError(err) {
+			http.Error(w, "username already taken", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, user, http.StatusCreated)
+}
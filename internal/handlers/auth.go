@@ -3,20 +3,41 @@ package handlers
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/brennanromance/heard/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// jwtSecret is the development secret used when KeyConfig.AllowDevSecret is
+// set. It is public, so tokens signed with it prove nothing.
 var jwtSecret = []byte("your-secret-key-change-this-in-production")
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+	mfaTokenTTL     = 5 * time.Minute
+)
+
+// mfaAudience marks tokens that only prove the password step of a two-step
+// login. They are never accepted as access tokens.
+const mfaAudience = "heard:mfa"
+
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserID       int                `json:"user_id"`
+	Username     string             `json:"username"`
+	Email        string             `json:"email"`
+	SessionID    string             `json:"sid,omitempty"`
+	Role         string             `json:"role,omitempty"`
+	CompanyRoles []CompanyRoleClaim `json:"company_roles,omitempty"`
+	// APIKeyID and Scopes are set when the request used an API key instead
+	// of a session token.
+	APIKeyID int      `json:"-"`
+	Scopes   []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -24,32 +45,37 @@ type contextKey string
 
 const userClaimsKey contextKey = "userClaims"
 
-// GenerateToken creates a JWT token for a user
-func GenerateToken(userID int, username, email string) (string, error) {
+// GenerateToken creates a short-lived JWT access token for a user's session
+func GenerateToken(user *models.User, sessionID string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		SessionID: sessionID,
+		Role:      user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	for _, cr := range user.CompanyRoles {
+		claims.CompanyRoles = append(claims.CompanyRoles, CompanyRoleClaim{CompanyID: cr.CompanyID, Role: cr.Role})
+	}
+	claims.Issuer = keys.issuer
+
+	return keys.sign(claims)
 }
 
 // ValidateToken parses and validates a JWT token
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
-
+	token, err := keys.parse(tokenString, claims)
 	if err != nil {
 		return nil, err
 	}
@@ -58,10 +84,46 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if slices.Contains(claims.Audience, mfaAudience) {
+		return nil, errors.New("two-factor authentication has not been completed")
+	}
+
 	return claims, nil
 }
 
-// AuthMiddleware is a middleware that checks for JWT in Authorization header
+// generateMFAToken issues the short-lived challenge token returned by /login
+// when the account still has to present a second factor.
+func generateMFAToken(userID int) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	claims := &jwt.RegisteredClaims{
+		ID:        jti,
+		Subject:   strconv.Itoa(userID),
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		Issuer:    keys.issuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	return keys.sign(claims)
+}
+
+// validateMFAToken returns the user an MFA challenge token was issued to.
+func validateMFAToken(tokenString string) (int, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := keys.parse(tokenString, claims)
+	if err != nil {
+		return 0, err
+	}
+	if !token.Valid || !slices.Contains(claims.Audience, mfaAudience) {
+		return 0, errors.New("invalid mfa token")
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+// AuthMiddleware is a middleware that checks for a JWT or an API key in the
+// Authorization header
 func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		authHeader := req.Header.Get("Authorization")
@@ -77,12 +139,39 @@ func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+		if strings.HasPrefix(tokenString, apiKeyPrefix) {
+			claims, status, err := h.apiKeyClaims(req, tokenString)
+			if err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			ctx := context.WithValue(req.Context(), userClaimsKey, claims)
+			next(w, req.WithContext(ctx))
+			return
+		}
+
 		claims, err := ValidateToken(tokenString)
 		if err != nil {
 			http.Error(w, "invalid token: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
+		revoked, err := h.tokens.IsRevoked(req.Context(), claims.ID, claims.SessionID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, "token has been revoked", http.StatusUnauthorized)
+			return
+		}
+		if claims.SessionID != "" {
+			if err := h.tokens.TouchSession(req.Context(), claims.SessionID, h.clientIP(req)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// Add claims to context
 		ctx := context.WithValue(req.Context(), userClaimsKey, claims)
 		next(w, req.WithContext(ctx))
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
 )
 
 type SignupRequest struct {
@@ -18,10 +24,52 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type AuthResponse struct {
-	Token   string       `json:"token"`
-	User    *models.User `json:"user"`
-	Message string       `json:"message,omitempty"`
+	Token        string       `json:"token,omitempty"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	ExpiresIn    int          `json:"expires_in,omitempty"`
+	User         *models.User `json:"user,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	// MFARequired is set instead of issuing tokens when the account has
+	// two-factor authentication; MFAToken must then be sent to /login/mfa.
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// issueTokens starts a new session for user and returns its first access and
+// refresh token pair.
+func (h *Handler) issueTokens(req *http.Request, user *models.User) (*AuthResponse, error) {
+	ctx := req.Context()
+	sid, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	session := &models.Session{ID: sid, UserID: user.ID, UserAgent: userAgent(req), IP: h.clientIP(req)}
+	if err := h.tokens.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	rt := &models.RefreshToken{SessionID: sid, UserID: user.ID, ExpiresAt: time.Now().Add(refreshTokenTTL)}
+	if err := h.tokens.CreateRefreshToken(ctx, rt, hashToken(refresh)); err != nil {
+		return nil, err
+	}
+	token, err := h.accessToken(ctx, user, sid)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
 }
 
 func (h *Handler) signupHandler(w http.ResponseWriter, req *http.Request) {
@@ -37,8 +85,28 @@ func (h *Handler) signupHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Validate input before touching the database
+	reqBody.Username = strings.TrimSpace(reqBody.Username)
+	reqBody.Email = strings.TrimSpace(reqBody.Email)
+	var fieldErrs []FieldError
+	if reqBody.Username == "" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "username", Code: "required", Message: "username is required"})
+	}
+	if !strings.Contains(reqBody.Email, "@") {
+		fieldErrs = append(fieldErrs, FieldError{Field: "email", Code: "invalid", Message: "a valid email address is required"})
+	}
+	pwErrs, err := h.passwordErrors("password", reqBody.Password, reqBody.Username, reqBody.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fieldErrs = append(fieldErrs, pwErrs...); len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
 	// Check if user already exists
-	_, err := h.users.GetByEmail(ctx, reqBody.Email)
+	_, err = h.users.GetByEmail(ctx, reqBody.Email)
 	if err == nil {
 		http.Error(w, "user with this email already exists", http.StatusConflict)
 		return
@@ -63,18 +131,19 @@ func (h *Handler) signupHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Generate token
-	token, err := GenerateToken(user.ID, user.Username, user.Email)
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("verification email for user %d: %v", user.ID, err)
+	}
+
+	// Generate tokens
+	resp, err := h.issueTokens(req, user)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	resp.Message = "signup successful"
 
-	writeJSON(w, AuthResponse{
-		Token:   token,
-		User:    user,
-		Message: "signup successful",
-	}, http.StatusCreated)
+	writeJSON(w, resp, http.StatusCreated)
 }
 
 func (h *Handler) loginHandler(w http.ResponseWriter, req *http.Request) {
@@ -90,30 +159,127 @@ func (h *Handler) loginHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Find user by email
+	// Refuse to check passwords while the account or address is locked out
+	ip := h.clientIP(req)
+	wait, err := h.loginLockout(ctx, loginReq.Email, ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	// Find user by email and verify password
 	user, err := h.users.GetByEmail(ctx, loginReq.Email)
+	if err == nil {
+		err = h.users.VerifyPassword(ctx, user.ID, loginReq.Password)
+	} else if errors.Is(err, sql.ErrNoRows) {
+		h.users.RejectPassword(loginReq.Password)
+	}
 	if err != nil {
+		wait, terr := h.loginFailed(ctx, loginReq.Email, ip)
+		if terr != nil {
+			http.Error(w, terr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeTooManyAttempts(w, wait)
+			return
+		}
 		http.Error(w, "invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	if err := h.loginSucceeded(ctx, loginReq.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Verify password
-	if err := h.users.VerifyPassword(ctx, user.ID, loginReq.Password); err != nil {
-		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+	h.finishLogin(w, req, user)
+}
+
+// finishLogin answers a successful first-factor login: accounts with 2FA get
+// a short-lived challenge, everyone else the usual token pair.
+func (h *Handler) finishLogin(w http.ResponseWriter, req *http.Request, user *models.User) {
+	if user.MFAEnabled {
+		mfaToken, err := generateMFAToken(user.ID)
+		if err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, AuthResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			Message:     "two-factor authentication required",
+		}, http.StatusOK)
 		return
 	}
 
-	// Generate token
-	token, err := GenerateToken(user.ID, user.Username, user.Email)
+	// Generate tokens
+	user.Password = ""
+	resp, err := h.issueTokens(req, user)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	resp.Message = "login successful"
+
+	writeJSON(w, resp, http.StatusOK)
+}
+
+func (h *Handler) refreshHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := req.Context()
+	var refreshReq RefreshRequest
+	if err := json.NewDecoder(req.Body).Decode(&refreshReq); err != nil || refreshReq.RefreshToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	rt := &models.RefreshToken{ExpiresAt: time.Now().Add(refreshTokenTTL)}
+	err = h.tokens.RotateRefreshToken(ctx, hashToken(refreshReq.RefreshToken), rt, hashToken(refresh), h.clientIP(req))
+	switch {
+	case errors.Is(err, repo.ErrRefreshTokenReused):
+		http.Error(w, "refresh token reuse detected, session revoked", http.StatusUnauthorized)
+		return
+	case errors.Is(err, repo.ErrRefreshTokenNotFound),
+		errors.Is(err, repo.ErrRefreshTokenExpired),
+		errors.Is(err, repo.ErrSessionRevoked):
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.users.GetByID(ctx, rt.UserID)
+	if err != nil {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	user.Password = ""
+
+	token, err := h.accessToken(ctx, user, rt.SessionID)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
 	writeJSON(w, AuthResponse{
-		Token:   token,
-		User:    user,
-		Message: "login successful",
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		User:         user,
 	}, http.StatusOK)
 }
 
@@ -123,8 +289,31 @@ func (h *Handler) logoutHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// In a JWT-based system, logout is typically handled on the client-side by deleting the token.
-	// This endpoint is provided as a convenience for API documentation.
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Revoke the access token itself and the session its refresh tokens belong to.
+	if claims.ID != "" {
+		expiresAt := time.Now().Add(accessTokenTTL)
+		if claims.ExpiresAt != nil {
+			expiresAt = claims.ExpiresAt.Time
+		}
+		if err := h.tokens.RevokeAccessToken(ctx, claims.ID, expiresAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if claims.SessionID != "" {
+		if err := h.tokens.RevokeSession(ctx, claims.SessionID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	writeJSON(w, map[string]string{
 		"message": "logout successful",
 	}, http.StatusOK)
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// authored describes a resource that is always shown under its author's
+// pseudonym for the company, such as a review or an interview report. Its
+// author is only revealed to the author.
+type authored[T any] struct {
+	noun   string
+	get    func(context.Context, int) (T, error)
+	author func(T) *int
+}
+
+// fromPath loads the resource named by the {id} path segment.
+func (a authored[T]) fromPath(w http.ResponseWriter, req *http.Request) (T, bool) {
+	var zero T
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return zero, false
+	}
+	v, err := a.get(req.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, a.noun+" not found", http.StatusNotFound)
+		return zero, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return zero, false
+	}
+	return v, true
+}
+
+// authorized loads the resource like fromPath and checks that the caller may
+// perform perm on it.
+func (a authored[T]) authorized(w http.ResponseWriter, req *http.Request, perm Permission) (T, bool) {
+	v, ok := a.fromPath(w, req)
+	if !ok {
+		return v, false
+	}
+	if _, ok := authorize(w, req, perm, Resource{OwnerID: a.author(v)}); !ok {
+		return v, false
+	}
+	return v, true
+}
+
+// redact hides the author of v from everyone but the author.
+func (a authored[T]) redact(v T, claims *Claims) {
+	if id := a.author(v); *id != claims.UserID {
+		*id = 0
+	}
+}
+
+// serveGET writes the resource named by the {id} path segment.
+func (a authored[T]) serveGET(w http.ResponseWriter, req *http.Request) {
+	claims, err := GetUserClaimsFromContext(req.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	v, ok := a.fromPath(w, req)
+	if !ok {
+		return
+	}
+	a.redact(v, claims)
+	writeJSON(w, v, http.StatusOK)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// Permission names an operation guarded by the authorization layer.
+type Permission string
+
+const (
+	PermEditPost              Permission = "post:edit"
+	PermDeletePost            Permission = "post:delete"
+	PermEditComment           Permission = "comment:edit"
+	PermDeleteComment         Permission = "comment:delete"
+	PermEditCompany           Permission = "company:edit"
+	PermDeleteCompany         Permission = "company:delete"
+	PermTransferCompany       Permission = "company:transfer"
+	PermManageCompanyDomains  Permission = "company:domains"
+	PermVerifyCompanyDomains  Permission = "company:domains:verify"
+	PermManageCompanyRoles    Permission = "company:roles"
+	PermDeanonymize           Permission = "moderation:deanonymize"
+	PermManageUserRoles       Permission = "users:roles"
+	PermUnlockAccounts        Permission = "users:unlock"
+	PermManageServiceAccounts Permission = "users:service-accounts"
+	PermEditReview            Permission = "review:edit"
+	PermDeleteReview          Permission = "review:delete"
+	PermEditInterview         Permission = "interview:edit"
+	PermDeleteInterview       Permission = "interview:delete"
+	PermImportCompanies       Permission = "companies:import"
+)
+
+// ownerPermissions are granted on resources the caller created.
+var ownerPermissions = permissionSet(
+	PermEditPost, PermDeletePost,
+	PermEditComment, PermDeleteComment,
+	PermEditCompany, PermDeleteCompany, PermManageCompanyDomains, PermManageCompanyRoles,
+	PermEditReview, PermDeleteReview,
+	PermEditInterview, PermDeleteInterview,
+)
+
+// rolePermissions are granted by a site-wide role on every resource.
+var rolePermissions = map[string]map[Permission]bool{
+	models.RoleModerator: permissionSet(
+		PermEditPost, PermDeletePost,
+		PermEditComment, PermDeleteComment,
+		PermDeleteReview, PermDeleteInterview,
+		PermDeanonymize,
+	),
+	models.RoleAdmin: permissionSet(
+		PermEditPost, PermDeletePost,
+		PermEditComment, PermDeleteComment,
+		PermDeleteReview, PermDeleteInterview,
+		PermEditCompany, PermDeleteCompany, PermTransferCompany, PermManageCompanyDomains, PermVerifyCompanyDomains, PermManageCompanyRoles,
+		PermDeanonymize, PermManageUserRoles, PermUnlockAccounts, PermManageServiceAccounts,
+		PermImportCompanies,
+	),
+}
+
+// companyRolePermissions are granted by a company-scoped role on resources
+// belonging to that company.
+var companyRolePermissions = map[string]map[Permission]bool{
+	models.CompanyRoleAdmin: permissionSet(PermEditCompany, PermManageCompanyDomains, PermManageCompanyRoles),
+}
+
+func permissionSet(perms ...Permission) map[Permission]bool {
+	set := make(map[Permission]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+// Resource describes what a permission is being checked against. Leave
+// fields nil when they don't apply.
+type Resource struct {
+	OwnerID   *int
+	CompanyID *int
+}
+
+// CompanyRoleClaim is a company-scoped role carried in the access token.
+type CompanyRoleClaim struct {
+	CompanyID int    `json:"company_id"`
+	Role      string `json:"role"`
+}
+
+// Can reports whether the token holder may perform perm on res.
+func (c *Claims) Can(perm Permission, res Resource) bool {
+	if rolePermissions[c.Role][perm] {
+		return true
+	}
+	if res.OwnerID != nil && *res.OwnerID == c.UserID && ownerPermissions[perm] {
+		return true
+	}
+	if res.CompanyID != nil {
+		for _, cr := range c.CompanyRoles {
+			if cr.CompanyID == *res.CompanyID && companyRolePermissions[cr.Role][perm] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize loads the caller's claims and checks perm on res, writing a 401 or
+// 403 and returning ok=false when the request must stop.
+func authorize(w http.ResponseWriter, req *http.Request, perm Permission, res Resource) (*Claims, bool) {
+	claims, err := GetUserClaimsFromContext(req.Context())
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !claims.Can(perm, res) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+func companyResource(c *models.Company) Resource {
+	return Resource{OwnerID: c.UserID, CompanyID: &c.ID}
+}
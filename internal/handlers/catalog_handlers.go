@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/brennanromance/heard/internal/catalog"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// Limits on a single catalog import.
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 10000
+)
+
+var catalogContentTypes = map[string]string{
+	catalog.FormatCSV:    "text/csv",
+	catalog.FormatNDJSON: "application/x-ndjson",
+}
+
+// importFormat picks the import format from ?format= or, failing that, the
+// request's Content-Type.
+func importFormat(req *http.Request) (string, error) {
+	if f := req.URL.Query().Get("format"); f != "" {
+		return f, nil
+	}
+	mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	for f, ct := range catalogContentTypes {
+		if mt == ct {
+			return f, nil
+		}
+	}
+	return "", errors.New("send text/csv or application/x-ndjson, or pass format=csv|ndjson")
+}
+
+// companyImportHandler upserts companies from a CSV or NDJSON body. Nothing
+// is written when any row fails or dry_run is set. Admin only.
+func (h *Handler) companyImportHandler(w http.ResponseWriter, req *http.Request) {
+	claims, ok := authorize(w, req, PermImportCompanies, Resource{})
+	if !ok {
+		return
+	}
+	format, err := importFormat(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	dryRun := false
+	if v := req.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	recs, err := catalog.Read(http.MaxBytesReader(w, req.Body, maxImportBytes), format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "import is larger than 10 MB", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	if len(recs) > maxImportRows {
+		http.Error(w, "import has more than "+strconv.Itoa(maxImportRows)+" rows", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errs := catalog.Check(recs); len(errs) > 0 {
+		writeJSON(w, repo.ImportResult{DryRun: dryRun, Errors: errs}, http.StatusUnprocessableEntity)
+		return
+	}
+	res, err := h.companies.Import(req.Context(), recs, claims.UserID, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code := http.StatusOK
+	if len(res.Errors) > 0 {
+		code = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, res, code)
+}
+
+// companyExportHandler streams the whole catalog as CSV (the default) or
+// NDJSON, in the format the importer accepts.
+func (h *Handler) companyExportHandler(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = catalog.FormatCSV
+	}
+	ct, ok := catalogContentTypes[format]
+	if !ok {
+		http.Error(w, catalog.ErrUnknownFormat.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Disposition", `attachment; filename="companies.`+format+`"`)
+	cw, err := catalog.NewWriter(w, format)
+	if err != nil {
+		log.Printf("company export: %v", err)
+		return
+	}
+	if err := h.companies.Export(req.Context(), cw.Write); err != nil {
+		log.Printf("company export: %v", err)
+		return
+	}
+	if err := cw.Flush(); err != nil {
+		log.Printf("company export: %v", err)
+	}
+}
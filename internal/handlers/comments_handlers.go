@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/brennanromance/heard/internal/models"
@@ -9,21 +12,59 @@ import (
 
 func (h *Handler) commentsHandlerGET(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	if id, ok := idFromQuery(req); ok {
 		c, err := h.comments.GetByID(ctx, id)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if err := h.markLikedComments(ctx, claims, c); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redactComment(c, claims)
 		writeJSON(w, c, http.StatusOK)
 		return
 	}
-	list, err := h.comments.List(ctx)
+	page, err := pageFromQuery(req)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.comments.List(ctx, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if err := h.markLikedComments(ctx, claims, list...); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, list, http.StatusOK)
+	for _, c := range list {
+		redactComment(c, claims)
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+var errPostNotFound = errors.New("post not found")
+
+// ensureCommentPseudonym makes sure userID has a pseudonym for the company
+// that postID is about, so an anonymous comment on it can be displayed.
+func (h *Handler) ensureCommentPseudonym(ctx context.Context, userID, postID int) error {
+	post, err := h.posts.GetByID(ctx, postID)
+	if err != nil {
+		return errPostNotFound
+	}
+	if post.CompanyID == nil {
+		return errors.New("anonymous comments require the post to have a company")
+	}
+	_, err = h.pseudonymFor(ctx, userID, *post.CompanyID)
+	return err
 }
 
 func (h *Handler) commentsHandlerPOST(w http.ResponseWriter, req *http.Request) {
@@ -40,11 +81,26 @@ func (h *Handler) commentsHandlerPOST(w http.ResponseWriter, req *http.Request)
 		return
 	}
 	c.UserID = claims.UserID
+	if c.Anonymous {
+		if err := h.ensureCommentPseudonym(ctx, c.UserID, c.PostID); err != nil {
+			if errors.Is(err, errPostNotFound) {
+				http.Error(w, "post not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
 	if err := h.comments.Create(ctx, &c); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, c, http.StatusCreated)
+	created, err := h.comments.GetByID(ctx, c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, created, http.StatusCreated)
 }
 
 type likeCommentRequest struct {
@@ -67,12 +123,32 @@ func (h *Handler) likeCommentHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
-	liked, err := h.comments.ToggleLike(ctx, claims.UserID, r.CommentID)
+	liked, likes, err := h.comments.ToggleLike(ctx, claims.UserID, r.CommentID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
-	writeJSON(w, map[string]bool{"liked": liked}, http.StatusOK)
+	writeJSON(w, likeResponse{Liked: liked, Likes: likes}, http.StatusOK)
+}
+
+// markLikedComments sets LikedByMe on comments the caller has liked.
+func (h *Handler) markLikedComments(ctx context.Context, claims *Claims, comments ...*models.Comment) error {
+	ids := make([]int, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	liked, err := h.comments.LikedBy(ctx, claims.UserID, ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		c.LikedByMe = liked[c.ID]
+	}
+	return nil
 }
 
 func (h *Handler) commentsHandlerPUT(w http.ResponseWriter, req *http.Request) {
@@ -82,20 +158,14 @@ func (h *Handler) commentsHandlerPUT(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	// Get the comment to verify ownership
+	// Get the comment to verify the caller may edit it
 	existing, err := h.comments.GetByID(ctx, id)
 	if err != nil {
 		http.Error(w, "comment not found", http.StatusNotFound)
 		return
 	}
-	// Verify the user owns this comment
-	claims, err := GetUserClaimsFromContext(ctx)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	if existing.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	claims, ok := authorize(w, req, PermEditComment, Resource{OwnerID: &existing.UserID})
+	if !ok {
 		return
 	}
 	var c models.Comment
@@ -104,12 +174,39 @@ func (h *Handler) commentsHandlerPUT(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	c.ID = id
-	c.UserID = claims.UserID
+	// The author never changes, even when a moderator edits the comment
+	c.UserID = existing.UserID
+	// Only the author may reveal themselves or move the comment to another
+	// post; see postsHandlerPUT.
+	if claims.UserID != existing.UserID {
+		c.Anonymous = existing.Anonymous
+		c.PostID = existing.PostID
+	}
+	if c.Anonymous {
+		if err := h.ensureCommentPseudonym(ctx, c.UserID, c.PostID); err != nil {
+			if errors.Is(err, errPostNotFound) {
+				http.Error(w, "post not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
 	if err := h.comments.Update(ctx, &c); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, c, http.StatusOK)
+	updated, err := h.comments.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.markLikedComments(ctx, claims, updated); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redactComment(updated, claims)
+	writeJSON(w, updated, http.StatusOK)
 }
 
 func (h *Handler) commentsHandlerDELETE(w http.ResponseWriter, req *http.Request) {
@@ -119,20 +216,13 @@ func (h *Handler) commentsHandlerDELETE(w http.ResponseWriter, req *http.Request
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	// Get the comment to verify ownership
+	// Get the comment to verify the caller may delete it
 	existing, err := h.comments.GetByID(ctx, id)
 	if err != nil {
 		http.Error(w, "comment not found", http.StatusNotFound)
 		return
 	}
-	// Verify the user owns this comment
-	claims, err := GetUserClaimsFromContext(ctx)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	if existing.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := authorize(w, req, PermDeleteComment, Resource{OwnerID: &existing.UserID}); !ok {
 		return
 	}
 	if err := h.comments.Delete(ctx, id); err != nil {
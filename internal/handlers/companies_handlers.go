@@ -1,10 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
 )
 
 func (h *Handler) companiesHandlerGET(w http.ResponseWriter, req *http.Request) {
@@ -18,14 +26,148 @@ func (h *Handler) companiesHandlerGET(w http.ResponseWriter, req *http.Request)
 		writeJSON(w, c, http.StatusOK)
 		return
 	}
-	list, err := h.companies.List(ctx)
+	filter, err := companyFilterFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.companies.List(ctx, filter, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+// companyFilterFromQuery reads the search, filter and sort parameters of
+// GET /companies.
+func companyFilterFromQuery(req *http.Request) (repo.CompanyFilter, error) {
+	q := req.URL.Query()
+	f := repo.CompanyFilter{
+		Query:       strings.TrimSpace(q.Get("q")),
+		Prefix:      strings.TrimSpace(q.Get("prefix")),
+		Industry:    strings.TrimSpace(q.Get("industry")),
+		SubIndustry: strings.TrimSpace(q.Get("sub_industry")),
+		HQCity:      strings.TrimSpace(q.Get("hq_city")),
+		HQState:     strings.TrimSpace(q.Get("hq_state")),
+		Sort:        q.Get("sort"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"incorporated_after", &f.IncorporatedAfter},
+		{"incorporated_before", &f.IncorporatedBefore},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return f, fmt.Errorf("%s must be a date in YYYY-MM-DD format", p.name)
+		}
+		*p.dst = &t
+	}
+	if !repo.ValidCompanySort(f.Sort) {
+		return f, errors.New("sort must be one of name, incorporated or activity, optionally prefixed with -")
+	}
+	return f, nil
+}
+
+// companyFromPath loads the company named by the {id} path segment.
+func (h *Handler) companyFromPath(w http.ResponseWriter, req *http.Request) (*models.Company, bool) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return nil, false
+	}
+	c, err := h.companies.GetByID(req.Context(), id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return nil, false
+	}
+	return c, true
+}
+
+// companySubsidiariesHandler returns the tree of companies below a company.
+func (h *Handler) companySubsidiariesHandler(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	tree, err := h.companies.Subsidiaries(req.Context(), c.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	writeJSON(w, models.CompanyNode{Company: *c, Subsidiaries: tree}, http.StatusOK)
+}
+
+// companyAncestorsHandler returns a company's parents, nearest first.
+func (h *Handler) companyAncestorsHandler(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	list, err := h.companies.Ancestors(req.Context(), c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []*models.Company{}
+	}
 	writeJSON(w, list, http.StatusOK)
 }
 
+// includeSubsidiaries reads the include_subsidiaries flag of rollup
+// endpoints.
+func includeSubsidiaries(req *http.Request) (bool, error) {
+	v := req.URL.Query().Get("include_subsidiaries")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("include_subsidiaries must be true or false")
+	}
+	return b, nil
+}
+
+// parentCompany validates a parent_company_id update for company id. null
+// detaches the company; otherwise the parent must exist and must not be the
+// company itself or one of its subsidiaries.
+func (h *Handler) parentCompany(ctx context.Context, id int, v interface{}) (*int, []FieldError, error) {
+	if v == nil {
+		return nil, nil, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) {
+		return nil, []FieldError{{Field: "parent_company_id", Code: "invalid", Message: "parent_company_id must be a company id or null"}}, nil
+	}
+	parentID := int(f)
+	if _, err := h.companies.GetByID(ctx, parentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, []FieldError{{Field: "parent_company_id", Code: "not_found", Message: "parent company does not exist"}}, nil
+		}
+		return nil, nil, err
+	}
+	cycle, err := h.companies.WouldCycle(ctx, id, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cycle {
+		return nil, []FieldError{{Field: "parent_company_id", Code: "cycle", Message: "a company cannot be owned by itself or one of its subsidiaries"}}, nil
+	}
+	return &parentID, nil, nil
+}
+
 func (h *Handler) companiesHandlerPOST(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	var c models.Company
@@ -40,6 +182,39 @@ func (h *Handler) companiesHandlerPOST(w http.ResponseWriter, req *http.Request)
 		return
 	}
 	c.UserID = &claims.UserID
+	c.Name = strings.Join(strings.Fields(c.Name), " ")
+	if c.Name == "" {
+		writeValidationErrors(w, []FieldError{{Field: "name", Code: "required", Message: "name is required"}})
+		return
+	}
+	if c.ParentCompanyID != nil {
+		// A new company has no subsidiaries, so id 0 never forms a cycle
+		_, errs, err := h.parentCompany(ctx, 0, float64(*c.ParentCompanyID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+	}
+	// Point the caller at existing companies rather than creating duplicates;
+	// near misses can be overridden with force=true
+	matches, err := h.companies.Resolve(ctx, c.Name, duplicateMatchScore, 5)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(matches) > 0 && matches[0].Score == 1 {
+		writeJSON(w, duplicateCompanyResponse{Error: "company with this name already exists", Matches: matches}, http.StatusConflict)
+		return
+	}
+	force, _ := strconv.ParseBool(req.URL.Query().Get("force"))
+	if len(matches) > 0 && !force {
+		writeJSON(w, duplicateCompanyResponse{Error: "similar companies already exist; retry with force=true to create it anyway", Matches: matches}, http.StatusConflict)
+		return
+	}
 	if err := h.companies.Create(ctx, &c); err != nil {
 		if isDuplicateKeyError(err) {
 			http.Error(w, "company with this name already exists", http.StatusConflict)
@@ -58,20 +233,14 @@ func (h *Handler) companiesHandlerPATCH(w http.ResponseWriter, req *http.Request
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	// Get the existing company to verify ownership and preserve unmodified fields
+	// Get the existing company to verify access and preserve unmodified fields
 	existing, err := h.companies.GetByID(ctx, id)
 	if err != nil {
 		http.Error(w, "company not found", http.StatusNotFound)
 		return
 	}
-	// Verify the user owns this company
-	claims, err := GetUserClaimsFromContext(ctx)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	if existing.UserID == nil || *existing.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	claims, ok := authorize(w, req, PermEditCompany, companyResource(existing))
+	if !ok {
 		return
 	}
 	// Decode only the fields provided in the request
@@ -81,15 +250,39 @@ func (h *Handler) companiesHandlerPATCH(w http.ResponseWriter, req *http.Request
 		return
 	}
 	// Apply updates only to provided fields
-	if name, ok := updates["name"].(string); ok && name != "" {
+	// Renames follow the rules for new names: the result may not be another
+	// company's name, alias or ticker
+	if name, ok := updates["name"].(string); ok {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" {
+			writeValidationErrors(w, []FieldError{{Field: "name", Code: "required", Message: "name is required"}})
+			return
+		}
+		conflict, err := h.nameConflict(req, name, existing.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if conflict != nil {
+			writeJSON(w, duplicateCompanyResponse{Error: "another company is already known by this name", Matches: []*models.CompanyMatch{conflict}}, http.StatusConflict)
+			return
+		}
 		existing.Name = name
 	}
 	if desc, ok := updates["description"].(string); ok {
 		existing.Description = &desc
 	}
-	if parentID, ok := updates["parent_company_id"].(float64); ok {
-		id := int(parentID)
-		existing.ParentCompanyID = &id
+	if v, present := updates["parent_company_id"]; present {
+		parentID, errs, err := h.parentCompany(ctx, existing.ID, v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		existing.ParentCompanyID = parentID
 	}
 	if industry, ok := updates["industry"].(string); ok {
 		existing.Industry = &industry
@@ -103,7 +296,19 @@ func (h *Handler) companiesHandlerPATCH(w http.ResponseWriter, req *http.Request
 	if dateInc, ok := updates["date_incorporated"].(string); ok {
 		existing.DateIncorporated = &dateInc
 	}
-	// user_id cannot be changed
+	// user_id can only be reassigned by admins, e.g. when the creator has left
+	if _, present := updates["user_id"]; present {
+		if !claims.Can(PermTransferCompany, companyResource(existing)) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if uid, ok := updates["user_id"].(float64); ok {
+			u := int(uid)
+			existing.UserID = &u
+		} else {
+			existing.UserID = nil
+		}
+	}
 	if err := h.companies.Update(ctx, existing); err != nil {
 		if isDuplicateKeyError(err) {
 			http.Error(w, "company with this name already exists", http.StatusConflict)
@@ -122,20 +327,13 @@ func (h *Handler) companiesHandlerDELETE(w http.ResponseWriter, req *http.Reques
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	// Get the company to verify ownership
+	// Get the company to verify access
 	existing, err := h.companies.GetByID(ctx, id)
 	if err != nil {
 		http.Error(w, "company not found", http.StatusNotFound)
 		return
 	}
-	// Verify the user owns this company
-	claims, err := GetUserClaimsFromContext(ctx)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	if existing.UserID == nil || *existing.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := authorize(w, req, PermDeleteCompany, companyResource(existing)); !ok {
 		return
 	}
 	if err := h.companies.Delete(ctx, id); err != nil {
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+const (
+	defaultResolveLimit = 10
+	maxResolveLimit     = 50
+	// duplicateMatchScore is how close an existing company must be before
+	// creating a new one asks for confirmation.
+	duplicateMatchScore = 0.6
+)
+
+// companyResolveHandler looks a company up by name, alias or ticker,
+// tolerating typos, and returns the best matches first.
+func (h *Handler) companyResolveHandler(w http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	limit := defaultResolveLimit
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxResolveLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxResolveLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	matches, err := h.companies.Resolve(req.Context(), q, 0, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, matches, http.StatusOK)
+}
+
+type duplicateCompanyResponse struct {
+	Error   string                 `json:"error"`
+	Matches []*models.CompanyMatch `json:"matches"`
+}
+
+// nameConflict reports an existing company, other than companyID, whose name,
+// alias or ticker is exactly name.
+func (h *Handler) nameConflict(req *http.Request, name string, companyID int) (*models.CompanyMatch, error) {
+	matches, err := h.companies.Resolve(req.Context(), name, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		if m.Company.ID != companyID {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+func (h *Handler) companyAliasesHandlerGET(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	list, err := h.companies.ListAliases(req.Context(), c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list, http.StatusOK)
+}
+
+// companyAliasesHandlerPOST adds an alias. An alias may not be another
+// company's name, alias or ticker.
+func (h *Handler) companyAliasesHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	if _, ok := authorize(w, req, PermEditCompany, companyResource(c)); !ok {
+		return
+	}
+	var a models.CompanyAlias
+	if err := json.NewDecoder(req.Body).Decode(&a); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	a.CompanyID = c.ID
+	a.Alias = strings.Join(strings.Fields(a.Alias), " ")
+	switch {
+	case a.Alias == "":
+		writeValidationErrors(w, []FieldError{{Field: "alias", Code: "required", Message: "alias is required"}})
+		return
+	case len(a.Alias) > 255:
+		writeValidationErrors(w, []FieldError{{Field: "alias", Code: "too_long", Message: "alias must be at most 255 characters"}})
+		return
+	}
+	conflict, err := h.nameConflict(req, a.Alias, c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict != nil {
+		writeJSON(w, duplicateCompanyResponse{Error: "another company is already known by this name", Matches: []*models.CompanyMatch{conflict}}, http.StatusConflict)
+		return
+	}
+	if err := h.companies.AddAlias(req.Context(), &a); err != nil {
+		if errors.Is(err, repo.ErrAliasTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, a, http.StatusCreated)
+}
+
+func (h *Handler) companyAliasHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	h.deleteCompanyName(w, req, "alias", h.companies.DeleteAlias)
+}
+
+func (h *Handler) companyTickersHandlerGET(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	list, err := h.companies.ListTickers(req.Context(), c.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list, http.StatusOK)
+}
+
+func (h *Handler) companyTickersHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	if _, ok := authorize(w, req, PermEditCompany, companyResource(c)); !ok {
+		return
+	}
+	var t models.CompanyTicker
+	if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	t.CompanyID = c.ID
+	if errs := tickerErrors(&t); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if err := h.companies.AddTicker(req.Context(), &t); err != nil {
+		if errors.Is(err, repo.ErrTickerTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, t, http.StatusCreated)
+}
+
+func (h *Handler) companyTickerHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	h.deleteCompanyName(w, req, "ticker", h.companies.DeleteTicker)
+}
+
+// deleteCompanyName removes the alias or ticker named by the {name_id} path
+// segment from the company named by {id}.
+func (h *Handler) deleteCompanyName(w http.ResponseWriter, req *http.Request, kind string, del func(ctx context.Context, companyID, id int) error) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	if _, ok := authorize(w, req, PermEditCompany, companyResource(c)); !ok {
+		return
+	}
+	id, err := strconv.Atoi(req.PathValue("name_id"))
+	if err != nil {
+		http.Error(w, "invalid "+kind+" id", http.StatusBadRequest)
+		return
+	}
+	if err := del(req.Context(), c.ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, kind+" not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tickerErrors validates a ticker, upper-casing it in place.
+func tickerErrors(t *models.CompanyTicker) []FieldError {
+	var errs []FieldError
+	t.Symbol = strings.ToUpper(strings.TrimSpace(t.Symbol))
+	switch {
+	case t.Symbol == "":
+		errs = append(errs, FieldError{Field: "symbol", Code: "required", Message: "symbol is required"})
+	case len(t.Symbol) > 10 || strings.Trim(t.Symbol, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-") != "":
+		errs = append(errs, FieldError{Field: "symbol", Code: "invalid", Message: "symbol must be up to 10 letters, digits, dots or dashes"})
+	}
+	if t.Exchange != nil {
+		e := strings.ToUpper(strings.TrimSpace(*t.Exchange))
+		switch {
+		case e == "":
+			t.Exchange = nil
+		case len(e) > 20:
+			errs = append(errs, FieldError{Field: "exchange", Code: "too_long", Message: "exchange must be at most 20 characters"})
+		default:
+			t.Exchange = &e
+		}
+	}
+	return errs
+}
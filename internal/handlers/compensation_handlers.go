@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// defaultCompensationMinUsers is how many distinct people must have reported
+// pay in a group before its aggregate is shown.
+const defaultCompensationMinUsers = repo.CompensationMinUsers
+
+// SetCompensationMinUsers changes the k-anonymity threshold for pay
+// aggregates. It cannot go below repo.CompensationMinUsers.
+func (h *Handler) SetCompensationMinUsers(n int) { h.compensationMinUsers = n }
+
+func (h *Handler) compensationHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	var s models.Compensation
+	if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	s.CompanyID = c.ID
+	s.UserID = claims.UserID
+	if errs := compensationErrors(&s); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if err := h.compensation.Create(ctx, &s); err != nil {
+		if errors.Is(err, repo.ErrCompensationExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, s, http.StatusCreated)
+}
+
+// compensationStatsHandler returns pay percentiles for the groups that have
+// enough distinct submitters.
+func (h *Handler) compensationStatsHandler(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	cq := repo.CompensationQuery{
+		Title:    strings.TrimSpace(q.Get("title")),
+		Level:    strings.TrimSpace(q.Get("level")),
+		Location: strings.TrimSpace(q.Get("location")),
+		Currency: strings.TrimSpace(q.Get("currency")),
+		MinUsers: h.compensationMinUsers,
+	}
+	if v := q.Get("company_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "company_id must be an integer", http.StatusBadRequest)
+			return
+		}
+		cq.CompanyID = id
+	}
+	rollup, err := includeSubsidiaries(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cq.IncludeSubsidiaries = rollup
+	seen := map[string]bool{}
+	for _, g := range strings.Split(q.Get("group_by"), ",") {
+		g = strings.TrimSpace(g)
+		if g == "" || seen[g] {
+			continue
+		}
+		if !repo.ValidCompensationGroup(g) {
+			http.Error(w, "group_by must list company, title, level or location", http.StatusBadRequest)
+			return
+		}
+		seen[g] = true
+		cq.GroupBy = append(cq.GroupBy, g)
+	}
+	stats, err := h.compensation.Stats(req.Context(), cq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"min_users": cq.MinUsers, "groups": stats}, http.StatusOK)
+}
+
+// myCompensationHandlerGET lists the caller's own submissions.
+func (h *Handler) myCompensationHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.compensation.PageByUser(ctx, claims.UserID, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+func (h *Handler) myCompensationHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := h.compensation.Delete(ctx, id, claims.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "submission not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// compensationErrors validates a submission, trimming and normalising its
+// text fields in place.
+func compensationErrors(s *models.Compensation) []FieldError {
+	var errs []FieldError
+	s.Title = strings.Join(strings.Fields(s.Title), " ")
+	switch {
+	case s.Title == "":
+		errs = append(errs, FieldError{Field: "title", Code: "required", Message: "title is required"})
+	case len(s.Title) > 255:
+		errs = append(errs, FieldError{Field: "title", Code: "too_long", Message: "title must be at most 255 characters"})
+	}
+	for _, f := range []struct {
+		field string
+		v     **string
+		max   int
+	}{
+		{"level", &s.Level, 64},
+		{"location", &s.Location, 255},
+	} {
+		if *f.v == nil {
+			continue
+		}
+		t := strings.Join(strings.Fields(**f.v), " ")
+		if t == "" {
+			*f.v = nil
+			continue
+		}
+		if len(t) > f.max {
+			errs = append(errs, FieldError{Field: f.field, Code: "too_long", Message: fmt.Sprintf("%s must be at most %d characters", f.field, f.max)})
+		}
+		*f.v = &t
+	}
+	if s.YearsExperience < 0 || s.YearsExperience > 70 {
+		errs = append(errs, FieldError{Field: "years_experience", Code: "out_of_range", Message: "years_experience must be between 0 and 70"})
+	}
+	s.Currency = strings.ToUpper(strings.TrimSpace(s.Currency))
+	if s.Currency == "" {
+		s.Currency = "USD"
+	}
+	if len(s.Currency) != 3 || strings.Trim(s.Currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		errs = append(errs, FieldError{Field: "currency", Code: "invalid", Message: "currency must be a three-letter ISO 4217 code"})
+	}
+	if s.BaseSalary <= 0 || s.BaseSalary > math.MaxInt32 {
+		errs = append(errs, FieldError{Field: "base_salary", Code: "out_of_range", Message: "base_salary must be a positive yearly amount"})
+	}
+	for _, f := range []struct {
+		field string
+		v     int
+	}{
+		{"bonus", s.Bonus},
+		{"equity", s.Equity},
+	} {
+		if f.v < 0 || f.v > math.MaxInt32 {
+			errs = append(errs, FieldError{Field: f.field, Code: "out_of_range", Message: f.field + " must be a yearly amount of at least 0"})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// exportHandler streams a zip archive holding one JSON file per kind of data
+// stored about the authenticated user.
+func (h *Handler) exportHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	user.Password = ""
+	if user.CompanyRoles, err = h.roles.CompanyRolesForUser(ctx, user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	posts, err := h.posts.ListByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comments, err := h.comments.ListByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	likes, err := h.posts.LikesByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	commentLikes, err := h.comments.LikesByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	likes = append(likes, commentLikes...)
+	companies, err := h.companies.ListByOwner(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	affiliations, err := h.affiliations.ListForUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	identities, err := h.identities.ListForUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	apiKeys, err := h.apiKeys.ListForUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reviews, err := h.reviews.ListByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	compensation, err := h.compensation.ListByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	interviews, err := h.interviews.ListByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	follows, err := h.follows.ListByUser(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", user},
+		{"posts.json", posts},
+		{"comments.json", comments},
+		{"reviews.json", reviews},
+		{"compensation.json", compensation},
+		{"interviews.json", interviews},
+		{"likes.json", likes},
+		{"follows.json", follows},
+		{"companies.json", companies},
+		{"affiliations.json", affiliations},
+		{"identities.json", identities},
+		{"api_keys.json", apiKeys},
+	}
+
+	filename := fmt.Sprintf("heard-export-%s-%s.zip", user.Username, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			log.Printf("export for user %d: %v", user.ID, err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			log.Printf("export for user %d: %v", user.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("export for user %d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+type followRequest struct {
+	IncludeSubsidiaries *bool `json:"include_subsidiaries"`
+}
+
+// followHandlerPUT follows the company in the path. Subsidiaries are included
+// unless the body says otherwise; repeating the call updates that choice.
+func (h *Handler) followHandlerPUT(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	var r followRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	f := models.CompanyFollow{UserID: claims.UserID, CompanyID: c.ID, IncludeSubsidiaries: true, Company: c}
+	if r.IncludeSubsidiaries != nil {
+		f.IncludeSubsidiaries = *r.IncludeSubsidiaries
+	}
+	if err := h.follows.Follow(ctx, &f); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, f, http.StatusOK)
+}
+
+func (h *Handler) followHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	if err := h.follows.Unfollow(ctx, claims.UserID, c.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "not following this company", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// myFollowsHandlerGET lists the companies the caller follows.
+func (h *Handler) myFollowsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.follows.PageByUser(ctx, claims.UserID, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+// feedHandler returns posts about the companies the caller follows, ranked by
+// recency and engagement (sort=hot, the default) or newest first (sort=new).
+func (h *Handler) feedHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sort := req.URL.Query().Get("sort")
+	if sort == "" {
+		sort = repo.FeedSortHot
+	}
+	if !repo.ValidFeedSort(sort) {
+		http.Error(w, "sort must be hot or new", http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.posts.Feed(ctx, claims.UserID, sort, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if err := h.markLikedPosts(ctx, claims, list...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, p := range list {
+		redactPost(p, claims)
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
@@ -1,36 +1,174 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/brennanromance/heard/internal/mailer"
+	"github.com/brennanromance/heard/internal/oidc"
+	"github.com/brennanromance/heard/internal/password"
 	"github.com/brennanromance/heard/internal/repo"
+	"github.com/brennanromance/heard/internal/throttle"
 )
 
 type Handler struct {
-	companies *repo.CompanyRepo
-	users     *repo.UserRepo
-	posts     *repo.PostRepo
-	comments  *repo.CommentRepo
+	companies    *repo.CompanyRepo
+	users        *repo.UserRepo
+	posts        *repo.PostRepo
+	comments     *repo.CommentRepo
+	tokens       *repo.TokenRepo
+	affiliations *repo.AffiliationRepo
+	pseudonyms   *repo.PseudonymRepo
+	roles        *repo.RoleRepo
+	userTokens   *repo.UserTokenRepo
+	mfa          *repo.MFARepo
+	erasures     *repo.ErasureRepo
+	identities   *repo.IdentityRepo
+	apiKeys      *repo.APIKeyRepo
+	reviews      *repo.ReviewRepo
+	compensation *repo.CompensationRepo
+	interviews   *repo.InterviewRepo
+	follows      *repo.FollowRepo
+	mailer       mailer.Mailer
+	appURL       string
+	loginLimits  *loginThrottle
+	trustProxy   bool
+	oidc         map[string]*oidc.Provider
+	passwords    *password.Policy
+	// lookupTXT resolves DNS TXT records when verifying company domains.
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	// compensationMinUsers is the k-anonymity threshold for pay aggregates.
+	compensationMinUsers int
 }
 
-func NewHandler(c *repo.CompanyRepo, u *repo.UserRepo, p *repo.PostRepo, cm *repo.CommentRepo) *Handler {
-	return &Handler{companies: c, users: u, posts: p, comments: cm}
+func NewHandler(c *repo.CompanyRepo, u *repo.UserRepo, p *repo.PostRepo, cm *repo.CommentRepo, t *repo.TokenRepo, a *repo.AffiliationRepo, ps *repo.PseudonymRepo, r *repo.RoleRepo, ut *repo.UserTokenRepo, mf *repo.MFARepo, er *repo.ErasureRepo, id *repo.IdentityRepo, ak *repo.APIKeyRepo, rv *repo.ReviewRepo, cp *repo.CompensationRepo, iv *repo.InterviewRepo, fl *repo.FollowRepo, m mailer.Mailer) *Handler {
+	return &Handler{
+		companies:    c,
+		users:        u,
+		posts:        p,
+		comments:     cm,
+		tokens:       t,
+		affiliations: a,
+		pseudonyms:   ps,
+		roles:        r,
+		userTokens:   ut,
+		mfa:          mf,
+		erasures:     er,
+		identities:   id,
+		apiKeys:      ak,
+		reviews:      rv,
+		compensation: cp,
+		interviews:   iv,
+		follows:      fl,
+		mailer:       m,
+		loginLimits:  newLoginThrottle(throttle.NewMemoryStore(ipLoginPolicy.Window)),
+		passwords:    password.DefaultPolicy(),
+		lookupTXT:    net.DefaultResolver.LookupTXT,
+
+		compensationMinUsers: defaultCompensationMinUsers,
+	}
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Auth routes (no middleware)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.jwksHandler)
 	mux.HandleFunc("POST /signup", h.signupHandler)
 	mux.HandleFunc("POST /login", h.loginHandler)
-	mux.HandleFunc("POST /logout", h.logoutHandler)
+	mux.HandleFunc("POST /login/mfa", h.mfaLoginHandler)
+	mux.HandleFunc("POST /token/refresh", h.refreshHandler)
+	mux.HandleFunc("GET /auth/{provider}/login", h.oidcLoginHandler)
+	mux.HandleFunc("GET /auth/{provider}/callback", h.oidcCallbackHandler)
+	mux.HandleFunc("POST /logout", h.AuthMiddleware(h.logoutHandler))
+	mux.HandleFunc("POST /email/verify", h.verifyEmailHandler)
+	mux.HandleFunc("POST /email/verify/resend", h.AuthMiddleware(h.resendVerificationHandler))
+	mux.HandleFunc("POST /password/forgot", h.forgotPasswordHandler)
+	mux.HandleFunc("POST /password/reset", h.resetPasswordHandler)
+
+	// Two-factor authentication
+	mux.HandleFunc("GET /mfa", h.AuthMiddleware(h.mfaStatusHandler))
+	mux.HandleFunc("POST /mfa/totp/enroll", h.AuthMiddleware(h.totpEnrollHandler))
+	mux.HandleFunc("POST /mfa/totp/verify", h.AuthMiddleware(h.totpVerifyHandler))
+	mux.HandleFunc("POST /mfa/totp/disable", h.AuthMiddleware(h.totpDisableHandler))
+	mux.HandleFunc("POST /mfa/recovery-codes", h.AuthMiddleware(h.recoveryCodesHandler))
+
+	// Account
+	mux.HandleFunc("GET /me", h.AuthMiddleware(h.meHandlerGET))
+	mux.HandleFunc("PATCH /me", h.AuthMiddleware(h.meHandlerPATCH))
+	mux.HandleFunc("DELETE /me", h.AuthMiddleware(h.meHandlerDELETE))
+	mux.HandleFunc("POST /me/password", h.AuthMiddleware(h.changePasswordHandler))
+	mux.HandleFunc("GET /me/sessions", h.AuthMiddleware(h.sessionsHandlerGET))
+	mux.HandleFunc("DELETE /me/sessions/{id}", h.AuthMiddleware(h.sessionsHandlerDELETE))
+	mux.HandleFunc("GET /users/{username}", h.AuthMiddleware(h.userProfileHandlerGET))
+	mux.HandleFunc("GET /me/export", h.AuthMiddleware(h.exportHandler))
+	mux.HandleFunc("GET /erasure-requests/{id}", h.erasureStatusHandler)
+
+	// API keys
+	mux.HandleFunc("GET /api-keys", h.AuthMiddleware(h.apiKeysHandlerGET))
+	mux.HandleFunc("POST /api-keys", h.AuthMiddleware(h.apiKeysHandlerPOST))
+	mux.HandleFunc("DELETE /api-keys/{id}", h.AuthMiddleware(h.apiKeysHandlerDELETE))
 
 	// Protected routes
 	mux.HandleFunc("GET /companies", h.AuthMiddleware(h.companiesHandlerGET))
 	mux.HandleFunc("POST /companies", h.AuthMiddleware(h.companiesHandlerPOST))
 	mux.HandleFunc("PATCH /companies", h.AuthMiddleware(h.companiesHandlerPATCH))
 	mux.HandleFunc("DELETE /companies", h.AuthMiddleware(h.companiesHandlerDELETE))
+	mux.HandleFunc("GET /companies/export", h.AuthMiddleware(h.companyExportHandler))
+	mux.HandleFunc("GET /companies/resolve", h.AuthMiddleware(h.companyResolveHandler))
+	mux.HandleFunc("GET /companies/{id}/aliases", h.AuthMiddleware(h.companyAliasesHandlerGET))
+	mux.HandleFunc("POST /companies/{id}/aliases", h.AuthMiddleware(h.companyAliasesHandlerPOST))
+	mux.HandleFunc("DELETE /companies/{id}/aliases/{name_id}", h.AuthMiddleware(h.companyAliasHandlerDELETE))
+	mux.HandleFunc("GET /companies/{id}/tickers", h.AuthMiddleware(h.companyTickersHandlerGET))
+	mux.HandleFunc("POST /companies/{id}/tickers", h.AuthMiddleware(h.companyTickersHandlerPOST))
+	mux.HandleFunc("DELETE /companies/{id}/tickers/{name_id}", h.AuthMiddleware(h.companyTickerHandlerDELETE))
+	mux.HandleFunc("GET /companies/{id}/subsidiaries", h.AuthMiddleware(h.companySubsidiariesHandler))
+	mux.HandleFunc("GET /companies/{id}/ancestors", h.AuthMiddleware(h.companyAncestorsHandler))
+	mux.HandleFunc("GET /companies/{id}/ratings", h.AuthMiddleware(h.companyRatingsHandler))
+
+	// Reviews
+	mux.HandleFunc("GET /companies/{id}/reviews", h.AuthMiddleware(h.reviewsHandlerGET))
+	mux.HandleFunc("POST /companies/{id}/reviews", h.AuthMiddleware(h.reviewsHandlerPOST))
+	mux.HandleFunc("GET /reviews/{id}", h.AuthMiddleware(h.reviewHandlerGET))
+	mux.HandleFunc("PATCH /reviews/{id}", h.AuthMiddleware(h.reviewHandlerPATCH))
+	mux.HandleFunc("DELETE /reviews/{id}", h.AuthMiddleware(h.reviewHandlerDELETE))
+
+	// Interviews
+	mux.HandleFunc("GET /companies/{id}/interviews", h.AuthMiddleware(h.interviewsHandlerGET))
+	mux.HandleFunc("GET /companies/{id}/interviews/summary", h.AuthMiddleware(h.interviewSummaryHandler))
+	mux.HandleFunc("POST /companies/{id}/interviews", h.AuthMiddleware(h.interviewsHandlerPOST))
+	mux.HandleFunc("GET /interviews/{id}", h.AuthMiddleware(h.interviewHandlerGET))
+	mux.HandleFunc("PATCH /interviews/{id}", h.AuthMiddleware(h.interviewHandlerPATCH))
+	mux.HandleFunc("DELETE /interviews/{id}", h.AuthMiddleware(h.interviewHandlerDELETE))
+
+	// Compensation
+	mux.HandleFunc("POST /companies/{id}/compensation", h.AuthMiddleware(h.compensationHandlerPOST))
+	mux.HandleFunc("GET /compensation", h.AuthMiddleware(h.compensationStatsHandler))
+	mux.HandleFunc("GET /me/compensation", h.AuthMiddleware(h.myCompensationHandlerGET))
+	mux.HandleFunc("DELETE /me/compensation/{id}", h.AuthMiddleware(h.myCompensationHandlerDELETE))
+
+	mux.HandleFunc("PUT /companies/{id}/follow", h.AuthMiddleware(h.followHandlerPUT))
+	mux.HandleFunc("DELETE /companies/{id}/follow", h.AuthMiddleware(h.followHandlerDELETE))
+	mux.HandleFunc("GET /me/follows", h.AuthMiddleware(h.myFollowsHandlerGET))
+	mux.HandleFunc("GET /feed", h.AuthMiddleware(h.feedHandler))
+	mux.HandleFunc("GET /search", h.AuthMiddleware(h.searchHandler))
+
+	mux.HandleFunc("GET /companies/domains", h.AuthMiddleware(h.companyDomainsHandlerGET))
+	mux.HandleFunc("POST /companies/domains", h.AuthMiddleware(h.companyDomainsHandlerPOST))
+	mux.HandleFunc("DELETE /companies/domains", h.AuthMiddleware(h.companyDomainsHandlerDELETE))
+	mux.HandleFunc("POST /companies/domains/verify", h.AuthMiddleware(h.companyDomainVerifyHandler))
+
+	mux.HandleFunc("GET /companies/roles", h.AuthMiddleware(h.companyRolesHandlerGET))
+	mux.HandleFunc("POST /companies/roles", h.AuthMiddleware(h.companyRolesHandlerPOST))
+	mux.HandleFunc("DELETE /companies/roles", h.AuthMiddleware(h.companyRolesHandlerDELETE))
+
+	// Work email verification
+	mux.HandleFunc("GET /affiliations", h.AuthMiddleware(h.affiliationsHandlerGET))
+	mux.HandleFunc("POST /affiliations", h.AuthMiddleware(h.affiliationsHandlerPOST))
+	mux.HandleFunc("POST /affiliations/confirm", h.AuthMiddleware(h.affiliationsConfirmHandler))
+	mux.HandleFunc("DELETE /affiliations", h.AuthMiddleware(h.affiliationsHandlerDELETE))
 
 	mux.HandleFunc("GET /posts", h.AuthMiddleware(h.postsHandlerGET))
 	mux.HandleFunc("POST /posts", h.AuthMiddleware(h.postsHandlerPOST))
@@ -42,6 +180,17 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("PUT /comments", h.AuthMiddleware(h.commentsHandlerPUT))
 	mux.HandleFunc("DELETE /comments", h.AuthMiddleware(h.commentsHandlerDELETE))
 
+	// Administration
+	mux.HandleFunc("GET /admin/users", h.AuthMiddleware(h.usersHandlerGET))
+	mux.HandleFunc("PUT /admin/users/role", h.AuthMiddleware(h.userRoleHandlerPUT))
+	mux.HandleFunc("POST /admin/unlock", h.AuthMiddleware(h.unlockHandler))
+	mux.HandleFunc("POST /admin/service-accounts", h.AuthMiddleware(h.serviceAccountsHandlerPOST))
+	mux.HandleFunc("POST /admin/companies/import", h.AuthMiddleware(h.companyImportHandler))
+
+	// Moderation
+	mux.HandleFunc("POST /moderation/deanonymize", h.AuthMiddleware(h.deanonymizeHandler))
+	mux.HandleFunc("GET /moderation/deanonymizations", h.AuthMiddleware(h.deanonymizationsHandlerGET))
+
 	// Like endpoints
 	mux.HandleFunc("POST /likecomment", h.AuthMiddleware(h.likeCommentHandler))
 	mux.HandleFunc("POST /likepost", h.AuthMiddleware(h.likePostHandler))
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// maxInterviewStages bounds how many stages a report may list.
+const maxInterviewStages = 20
+
+// interviewFilterFromQuery reads the filters shared by the interview list and
+// summary endpoints for company c.
+func interviewFilterFromQuery(req *http.Request, c *models.Company) (repo.InterviewFilter, error) {
+	q := req.URL.Query()
+	f := repo.InterviewFilter{
+		CompanyID: c.ID,
+		Role:      strings.TrimSpace(q.Get("role")),
+		Outcome:   q.Get("outcome"),
+	}
+	rollup, err := includeSubsidiaries(req)
+	if err != nil {
+		return f, err
+	}
+	f.IncludeSubsidiaries = rollup
+	if f.Outcome != "" && !validInterviewOutcome(f.Outcome) {
+		return f, errors.New("outcome must be offer, reject or no_response")
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"min_difficulty", &f.MinDifficulty},
+		{"max_difficulty", &f.MaxDifficulty},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 5 {
+			return f, fmt.Errorf("%s must be between 1 and 5", p.name)
+		}
+		*p.dst = n
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"after", &f.After},
+		{"before", &f.Before},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return f, fmt.Errorf("%s must be a date in YYYY-MM-DD format", p.name)
+		}
+		*p.dst = &t
+	}
+	return f, nil
+}
+
+func validInterviewOutcome(o string) bool {
+	switch o {
+	case models.InterviewOffer, models.InterviewReject, models.InterviewNoResponse:
+		return true
+	}
+	return false
+}
+
+func (h *Handler) interviewsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	filter, err := interviewFilterFromQuery(req, c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.interviews.ListForCompany(ctx, filter, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	kind := h.interviewKind()
+	for _, iv := range list {
+		kind.redact(iv, claims)
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+// interviewSummaryHandler returns the offer rate and average difficulty of the
+// reports matching the list filters.
+func (h *Handler) interviewSummaryHandler(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	filter, err := interviewFilterFromQuery(req, c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := h.interviews.Summary(req.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, s, http.StatusOK)
+}
+
+func (h *Handler) interviewsHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	var iv models.Interview
+	if err := json.NewDecoder(req.Body).Decode(&iv); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	iv.CompanyID = c.ID
+	iv.UserID = claims.UserID
+	if errs := interviewErrors(&iv); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if _, err := h.pseudonymFor(ctx, claims.UserID, c.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.interviews.Create(ctx, &iv); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created, err := h.interviews.GetByID(ctx, iv.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, created, http.StatusCreated)
+}
+
+// interviewKind loads, authorizes and redacts interview reports.
+func (h *Handler) interviewKind() authored[*models.Interview] {
+	return authored[*models.Interview]{
+		noun:   "interview",
+		get:    h.interviews.GetByID,
+		author: func(v *models.Interview) *int { return &v.UserID },
+	}
+}
+
+func (h *Handler) interviewHandlerGET(w http.ResponseWriter, req *http.Request) {
+	h.interviewKind().serveGET(w, req)
+}
+
+// interviewHandlerPATCH updates the fields present in the body. Only the
+// author may edit a report.
+func (h *Handler) interviewHandlerPATCH(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	existing, ok := h.interviewKind().authorized(w, req, PermEditInterview)
+	if !ok {
+		return
+	}
+	iv := *existing
+	if err := json.NewDecoder(req.Body).Decode(&iv); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	iv.ID, iv.CompanyID, iv.UserID = existing.ID, existing.CompanyID, existing.UserID
+	if errs := interviewErrors(&iv); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if err := h.interviews.Update(ctx, &iv); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated, err := h.interviews.GetByID(ctx, iv.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, updated, http.StatusOK)
+}
+
+func (h *Handler) interviewHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	existing, ok := h.interviewKind().authorized(w, req, PermDeleteInterview)
+	if !ok {
+		return
+	}
+	if err := h.interviews.Delete(req.Context(), existing.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// interviewErrors validates a report, trimming its text fields in place.
+func interviewErrors(iv *models.Interview) []FieldError {
+	var errs []FieldError
+	iv.Role = strings.TrimSpace(iv.Role)
+	switch {
+	case iv.Role == "":
+		errs = append(errs, FieldError{Field: "role", Code: "required", Message: "role is required"})
+	case len(iv.Role) > 255:
+		errs = append(errs, FieldError{Field: "role", Code: "too_long", Message: "role must be at most 255 characters"})
+	}
+	if d, err := time.Parse("2006-01-02", iv.Date); err != nil {
+		errs = append(errs, FieldError{Field: "date", Code: "invalid", Message: "date must be in YYYY-MM-DD format"})
+	} else if d.After(time.Now()) {
+		errs = append(errs, FieldError{Field: "date", Code: "in_future", Message: "date cannot be in the future"})
+	}
+	if !validInterviewOutcome(iv.Outcome) {
+		errs = append(errs, FieldError{Field: "outcome", Code: "invalid", Message: "outcome must be offer, reject or no_response"})
+	}
+	if iv.Difficulty < 1 || iv.Difficulty > 5 {
+		errs = append(errs, FieldError{Field: "difficulty", Code: "out_of_range", Message: "difficulty must be between 1 and 5"})
+	}
+	stages := make([]string, 0, len(iv.Stages))
+	for _, s := range iv.Stages {
+		if s = strings.TrimSpace(s); s != "" {
+			stages = append(stages, s)
+		}
+	}
+	iv.Stages = stages
+	if len(iv.Stages) > maxInterviewStages {
+		errs = append(errs, FieldError{Field: "stages", Code: "too_many", Message: fmt.Sprintf("at most %d stages may be listed", maxInterviewStages)})
+	}
+	if iv.Questions != nil {
+		if q := strings.TrimSpace(*iv.Questions); q == "" {
+			iv.Questions = nil
+		} else {
+			iv.Questions = &q
+		}
+	}
+	return errs
+}
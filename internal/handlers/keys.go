@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyConfig describes where the JWT signing and verification keys come from.
+type KeyConfig struct {
+	// Algorithm is one of HS256, RS256 or EdDSA. Defaults to HS256.
+	Algorithm string
+	// Secret is the shared secret used with HS256.
+	Secret string
+	// AllowDevSecret lets HS256 fall back to the built-in development secret
+	// when Secret is empty. Never set it in production.
+	AllowDevSecret bool
+	// PrivateKeyFile is a PEM encoded RSA or Ed25519 private key used with
+	// RS256/EdDSA.
+	PrivateKeyFile string
+	// KeyID is the "kid" of the signing key. Derived from the key's JWK
+	// thumbprint when empty.
+	KeyID string
+	// VerifyKeyFiles lists additional "kid=path" PEM public keys that are
+	// still accepted, typically keys that were recently rotated out.
+	VerifyKeyFiles []string
+	// Issuer, when set, is written to and required in the "iss" claim.
+	Issuer string
+}
+
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// KeySet holds the current signing key and every key tokens may be verified
+// with.
+type KeySet struct {
+	signing jwtKey
+	verify  map[string]jwtKey
+	issuer  string
+}
+
+// keys starts out with a random secret so nothing is accepted until
+// SetKeySet installs the configured keys.
+var keys = mustHMACKeySet(randomSecret())
+
+// SetKeySet replaces the keys used by GenerateToken and ValidateToken.
+func SetKeySet(ks *KeySet) { keys = ks }
+
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func mustHMACKeySet(secret []byte) *KeySet {
+	k := jwtKey{method: jwt.SigningMethodHS256, key: secret}
+	return &KeySet{signing: k, verify: map[string]jwtKey{"": k}}
+}
+
+// LoadKeySet builds a KeySet from cfg.
+func LoadKeySet(cfg KeyConfig) (*KeySet, error) {
+	var signing jwtKey
+	alg := strings.ToUpper(cfg.Algorithm)
+	switch alg {
+	case "", "HS256":
+		secret := cfg.Secret
+		if secret == "" {
+			if !cfg.AllowDevSecret {
+				return nil, errors.New("HS256 requires a secret")
+			}
+			log.Printf("JWT_SECRET is not set, falling back to the built-in development secret")
+			secret = string(jwtSecret)
+		}
+		signing = jwtKey{kid: cfg.KeyID, method: jwt.SigningMethodHS256, key: []byte(secret)}
+	case "RS256", "EDDSA":
+		if cfg.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("%s requires a private key file", cfg.Algorithm)
+		}
+		priv, err := readPrivateKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signing = jwtKey{kid: cfg.KeyID, method: methodForKey(priv), key: priv}
+		if strings.ToUpper(signing.method.Alg()) != alg {
+			return nil, fmt.Errorf("private key in %s does not match algorithm %s", cfg.PrivateKeyFile, cfg.Algorithm)
+		}
+		if signing.kid == "" {
+			signing.kid, err = thumbprint(publicKey(priv))
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	ks := &KeySet{signing: signing, verify: map[string]jwtKey{}, issuer: cfg.Issuer}
+	ks.verify[signing.kid] = jwtKey{kid: signing.kid, method: signing.method, key: verificationKey(signing.key)}
+
+	for _, entry := range cfg.VerifyKeyFiles {
+		kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("verification key %q must have the form kid=path", entry)
+		}
+		pub, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		ks.verify[kid] = jwtKey{kid: kid, method: methodForKey(pub), key: pub}
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	if ks.signing.kid != "" {
+		token.Header["kid"] = ks.signing.kid
+	}
+	return token.SignedString(ks.signing.key)
+}
+
+func (ks *KeySet) parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	methods := make([]string, 0, len(ks.verify))
+	for _, k := range ks.verify {
+		methods = append(methods, k.method.Alg())
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods)}
+	if ks.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(ks.issuer))
+	}
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := ks.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.key, nil
+	}, opts...)
+}
+
+// JWK is a single public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public verification keys. Shared HMAC secrets are never
+// published.
+func (ks *KeySet) JWKS() []JWK {
+	out := []JWK{}
+	for _, k := range ks.verify {
+		jwk, ok := toJWK(k.key)
+		if !ok {
+			continue
+		}
+		jwk.Kid = k.kid
+		jwk.Use = "sig"
+		jwk.Alg = k.method.Alg()
+		out = append(out, jwk)
+	}
+	return out
+}
+
+func (h *Handler) jwksHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, map[string][]JWK{"keys": keys.JWKS()}, http.StatusOK)
+}
+
+func toJWK(key interface{}) (JWK, bool) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k)}, true
+	}
+	return JWK{}, false
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of a public key.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	jwk, ok := toJWK(pub)
+	if !ok {
+		return "", errors.New("unsupported public key type")
+	}
+	var canonical []byte
+	var err error
+	switch jwk.Kty {
+	case "RSA":
+		canonical, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	case "OKP":
+		canonical, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func methodForKey(key interface{}) jwt.SigningMethod {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwt.SigningMethodRS256
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodHS256
+}
+
+func verificationKey(key interface{}) interface{} {
+	if _, ok := key.([]byte); ok {
+		return key
+	}
+	return publicKey(key)
+}
+
+func publicKey(priv interface{}) crypto.PublicKey {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case ed25519.PrivateKey:
+		return k.Public()
+	}
+	return nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch key.(type) {
+		case *rsa.PrivateKey, ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, fmt.Errorf("%s: unsupported private key type %T", path, key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unable to parse private key", path)
+}
+
+// readPublicKey accepts a PKIX public key, a certificate or a private key.
+func readPublicKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var pub interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		pub = cert.PublicKey
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		priv, err := readPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		pub = publicKey(priv)
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported public key type %T", path, pub)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/throttle"
+)
+
+var (
+	// accountLoginPolicy guards a single account against password guessing.
+	accountLoginPolicy = throttle.Policy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: 15 * time.Minute, Window: time.Hour}
+	// ipLoginPolicy is looser: one address may legitimately serve many users.
+	ipLoginPolicy = throttle.Policy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: time.Hour}
+)
+
+type loginThrottle struct {
+	account *throttle.Throttler
+	ip      *throttle.Throttler
+}
+
+func newLoginThrottle(store throttle.Store) *loginThrottle {
+	return &loginThrottle{
+		account: throttle.New(store, accountLoginPolicy),
+		ip:      throttle.New(store, ipLoginPolicy),
+	}
+}
+
+type unlockRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+// SetLoginThrottleStore replaces the in-memory failed login store, e.g. with
+// a throttle.PostgresStore shared by every API instance.
+func (h *Handler) SetLoginThrottleStore(store throttle.Store) {
+	h.loginLimits = newLoginThrottle(store)
+}
+
+// SetTrustProxyHeaders makes clientIP honour X-Forwarded-For. Only enable it
+// behind a proxy that appends the address it saw to the header.
+func (h *Handler) SetTrustProxyHeaders(trust bool) { h.trustProxy = trust }
+
+// clientIP returns the address throttling and sessions are keyed by. Behind a
+// trusted proxy that is the last X-Forwarded-For entry, the one the proxy
+// added; earlier entries come from the client and can be anything.
+func (h *Handler) clientIP(req *http.Request) string {
+	if h.trustProxy {
+		if fwd := req.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			last := fwd[len(fwd)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string { return "ip:" + ip }
+
+// loginLockout returns how long a login for email from ip must wait.
+func (h *Handler) loginLockout(ctx context.Context, email, ip string) (time.Duration, error) {
+	acct, err := h.loginLimits.account.Check(ctx, accountThrottleKey(email))
+	if err != nil {
+		return 0, err
+	}
+	addr, err := h.loginLimits.ip.Check(ctx, ipThrottleKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	return max(acct, addr), nil
+}
+
+// loginFailed records a failed login and returns the resulting lockout.
+func (h *Handler) loginFailed(ctx context.Context, email, ip string) (time.Duration, error) {
+	acct, err := h.loginLimits.account.Fail(ctx, accountThrottleKey(email))
+	if err != nil {
+		return 0, err
+	}
+	addr, err := h.loginLimits.ip.Fail(ctx, ipThrottleKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	return max(acct, addr), nil
+}
+
+func (h *Handler) loginSucceeded(ctx context.Context, email string) error {
+	return h.loginLimits.account.Reset(ctx, accountThrottleKey(email))
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// unlockHandler clears failed login tracking for an account and/or an IP
+// address. Admin only.
+func (h *Handler) unlockHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if _, ok := authorize(w, req, PermUnlockAccounts, Resource{}); !ok {
+		return
+	}
+	var r unlockRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || (r.Email == "" && r.IP == "") {
+		http.Error(w, "email or ip is required", http.StatusBadRequest)
+		return
+	}
+	if r.Email != "" {
+		if err := h.loginLimits.account.Reset(ctx, accountThrottleKey(r.Email)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if r.IP != "" {
+		if err := h.loginLimits.ip.Reset(ctx, ipThrottleKey(r.IP)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, map[string]string{"message": "unlocked"}, http.StatusOK)
+}
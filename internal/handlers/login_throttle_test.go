@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		trust bool
+		fwd   []string
+		want  string
+	}{
+		{"no proxy", false, nil, "192.0.2.1"},
+		{"header ignored", false, []string{"198.51.100.7"}, "192.0.2.1"},
+		{"proxy entry", true, []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed entries skipped", true, []string{"203.0.113.9, 10.0.0.1, 198.51.100.7"}, "198.51.100.7"},
+		{"last header wins", true, []string{"203.0.113.9", "198.51.100.7"}, "198.51.100.7"},
+		{"ipv6", true, []string{"2001:DB8::1"}, "2001:db8::1"},
+		{"not an address", true, []string{"203.0.113.9, " + strings.Repeat("x", 100)}, "192.0.2.1"},
+		{"empty entry", true, []string{"203.0.113.9,"}, "192.0.2.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{trustProxy: tt.trust}
+			req := httptest.NewRequest("POST", "/login", nil)
+			req.RemoteAddr = "192.0.2.1:4711"
+			for _, v := range tt.fwd {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := h.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/totp"
+)
+
+const (
+	totpIssuer        = "Heard"
+	recoveryCodeCount = 10
+)
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type mfaDisableRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type totpEnrollResponse struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// newRecoveryCodes returns plaintext recovery codes of the form
+// "xxxxx-xxxxx" together with their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		codes[i] = raw[:5] + "-" + raw[5:10]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code.
+func (h *Handler) verifySecondFactor(ctx context.Context, userID int, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		secret, _, err := h.mfa.TOTP(ctx, userID)
+		if err != nil || secret == "" {
+			return false, err
+		}
+		counter, ok := totp.Validate(secret, code, time.Now(), 1)
+		if !ok {
+			return false, nil
+		}
+		return h.mfa.UseCounter(ctx, userID, counter)
+	}
+	if recoveryCode != "" {
+		return h.mfa.UseRecoveryCode(ctx, userID, hashRecoveryCode(recoveryCode))
+	}
+	return false, nil
+}
+
+// mfaStatusHandler reports whether 2FA is on and how many unused recovery
+// codes are left, so clients can prompt for new ones before they run out.
+func (h *Handler) mfaStatusHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_, enabled, err := h.mfa.TOTP(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	remaining := 0
+	if enabled {
+		if remaining, err = h.mfa.RemainingRecoveryCodes(ctx, claims.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, map[string]interface{}{"totp_enabled": enabled, "recovery_codes_remaining": remaining}, http.StatusOK)
+}
+
+// totpEnrollHandler creates a pending TOTP secret and recovery codes. The
+// secret only protects the account once confirmed via /mfa/totp/verify.
+func (h *Handler) totpEnrollHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, enabled, err := h.mfa.TOTP(ctx, claims.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if enabled {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.mfa.SetPendingTOTP(ctx, claims.UserID, secret, hashes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, totpEnrollResponse{
+		Secret:        secret,
+		OTPAuthURI:    totp.URI(totpIssuer, claims.Email, secret),
+		RecoveryCodes: codes,
+	}, http.StatusCreated)
+}
+
+func (h *Handler) totpVerifyHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r mfaCodeRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.Code == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	secret, enabled, err := h.mfa.TOTP(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if secret == "" {
+		http.Error(w, "no pending enrollment, call /mfa/totp/enroll first", http.StatusConflict)
+		return
+	}
+	if enabled {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	ok, err := h.verifySecondFactor(ctx, claims.UserID, r.Code, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	if err := h.mfa.Enable(ctx, claims.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "two-factor authentication enabled"}, http.StatusOK)
+}
+
+// totpDisableHandler turns 2FA off. It requires the password and a second
+// factor so a stolen access token alone cannot strip it.
+func (h *Handler) totpDisableHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r mfaDisableRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.users.VerifyPassword(ctx, claims.UserID, r.Password); err != nil {
+		h.rejectPassword(w, req, claims.UserID)
+		return
+	}
+	if _, enabled, err := h.mfa.TOTP(ctx, claims.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !enabled {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	ok, err := h.verifySecondFactor(ctx, claims.UserID, r.Code, r.RecoveryCode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	if err := h.mfa.Disable(ctx, claims.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "two-factor authentication disabled"}, http.StatusOK)
+}
+
+// recoveryCodesHandler replaces every recovery code after checking a current
+// TOTP code.
+func (h *Handler) recoveryCodesHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r mfaCodeRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.Code == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, enabled, err := h.mfa.TOTP(ctx, claims.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !enabled {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	ok, err := h.verifySecondFactor(ctx, claims.UserID, r.Code, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.mfa.ReplaceRecoveryCodes(ctx, claims.UserID, hashes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string][]string{"recovery_codes": codes}, http.StatusOK)
+}
+
+// mfaLoginHandler completes a two-step login: it exchanges the challenge
+// token from /login plus a second factor for the usual token pair.
+func (h *Handler) mfaLoginHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var r mfaLoginRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.MFAToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	userID, err := validateMFAToken(r.MFAToken)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.users.GetByID(ctx, userID)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	ip := h.clientIP(req)
+	wait, err := h.loginLockout(ctx, user.Email, ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	ok, err := h.verifySecondFactor(ctx, user.ID, r.Code, r.RecoveryCode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		wait, err := h.loginFailed(ctx, user.Email, ip)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeTooManyAttempts(w, wait)
+			return
+		}
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	user.Password = ""
+	resp, err := h.issueTokens(req, user)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	resp.Message = "login successful"
+	writeJSON(w, resp, http.StatusOK)
+}
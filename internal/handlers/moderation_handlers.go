@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+type deanonymizeRequest struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	Reason     string `json:"reason"`
+}
+
+type deanonymizeResponse struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	AuditID    int    `json:"audit_id"`
+}
+
+// deanonymizeHandler reveals the author of an anonymous post or comment to a
+// moderator. Every reveal is written to the audit log with its reason.
+func (h *Handler) deanonymizeHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, ok := authorize(w, req, PermDeanonymize, Resource{})
+	if !ok {
+		return
+	}
+	var r deanonymizeRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	r.Reason = strings.TrimSpace(r.Reason)
+	if r.Reason == "" {
+		http.Error(w, "a reason is required", http.StatusBadRequest)
+		return
+	}
+
+	var authorID int
+	switch r.TargetType {
+	case "post":
+		p, err := h.posts.GetByID(ctx, r.TargetID)
+		if err != nil {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		authorID = p.UserID
+	case "comment":
+		c, err := h.comments.GetByID(ctx, r.TargetID)
+		if err != nil {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		authorID = c.UserID
+	default:
+		http.Error(w, "target_type must be post or comment", http.StatusBadRequest)
+		return
+	}
+	author, err := h.users.GetByID(ctx, authorID)
+	if err != nil {
+		http.Error(w, "author not found", http.StatusNotFound)
+		return
+	}
+
+	entry := models.DeanonymizationLog{
+		ModeratorID: &claims.UserID,
+		TargetType:  r.TargetType,
+		TargetID:    r.TargetID,
+		UserID:      &author.ID,
+		Reason:      r.Reason,
+	}
+	if err := h.pseudonyms.LogDeanonymization(ctx, &entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, deanonymizeResponse{
+		TargetType: r.TargetType,
+		TargetID:   r.TargetID,
+		UserID:     author.ID,
+		Username:   author.Username,
+		AuditID:    entry.ID,
+	}, http.StatusOK)
+}
+
+func (h *Handler) deanonymizationsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if _, ok := authorize(w, req, PermDeanonymize, Resource{}); !ok {
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.pseudonyms.ListDeanonymizations(ctx, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/oidc"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+const (
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateCookie = "heard_oidc_state"
+)
+
+// AddOIDCProvider enables "Sign in with" for p under /auth/{name}/.
+func (h *Handler) AddOIDCProvider(p *oidc.Provider) {
+	if h.oidc == nil {
+		h.oidc = map[string]*oidc.Provider{}
+	}
+	h.oidc[p.Name()] = p
+}
+
+func (h *Handler) oidcProvider(w http.ResponseWriter, req *http.Request) (*oidc.Provider, bool) {
+	p, ok := h.oidc[req.PathValue("provider")]
+	if !ok {
+		http.Error(w, "unknown identity provider", http.StatusNotFound)
+	}
+	return p, ok
+}
+
+// oidcLoginHandler starts the authorization code flow and redirects the
+// browser to the provider.
+func (h *Handler) oidcLoginHandler(w http.ResponseWriter, req *http.Request) {
+	p, ok := h.oidcProvider(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+	state, err := oidc.NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	if err := h.identities.CreateLoginState(ctx, hashToken(state), p.Name(), nonce, verifier, time.Now().Add(oidcStateTTL)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Bind the state to this browser so a callback link cannot be replayed
+	// in someone else's.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   req.TLS != nil || strings.HasPrefix(h.appURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, req, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler finishes the flow: it redeems the code, finds or creates
+// the Heard account and answers like /login.
+func (h *Handler) oidcCallbackHandler(w http.ResponseWriter, req *http.Request) {
+	p, ok := h.oidcProvider(w, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+	q := req.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "sign in was not completed: "+e, http.StatusUnauthorized)
+		return
+	}
+	state, code := q.Get("state"), q.Get("code")
+	cookie, err := req.Cookie(oidcStateCookie)
+	if state == "" || code == "" || err != nil || cookie.Value != state {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/", MaxAge: -1})
+
+	nonce, verifier, err := h.identities.ConsumeLoginState(ctx, hashToken(state), p.Name())
+	if errors.Is(err, repo.ErrLoginStateInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	claims, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, "could not verify sign in with identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	user, status, err := h.userForIdentity(req, p.Name(), claims)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	h.finishLogin(w, req, user)
+}
+
+// userForIdentity resolves the Heard account for a verified ID token. Known
+// identities sign in directly. Otherwise the identity is linked to the account
+// with the same email, provided both sides have verified that address, or a
+// new account is created when the provider has verified it.
+func (h *Handler) userForIdentity(req *http.Request, provider string, claims *oidc.Claims) (*models.User, int, error) {
+	ctx := req.Context()
+	userID, err := h.identities.FindUser(ctx, provider, claims.Subject)
+	if err == nil {
+		user, err := h.users.GetByID(ctx, userID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return user, 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, http.StatusInternalServerError, err
+	}
+	if claims.Email == "" {
+		return nil, http.StatusBadRequest, errors.New("the identity provider did not share an email address")
+	}
+
+	identity := &models.Identity{Provider: provider, Subject: claims.Subject, Email: claims.Email}
+	user, err := h.users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Linking to an unverified account would let whoever registered
+		// the address first keep access to it.
+		if !claims.EmailVerified || !user.EmailVerified {
+			return nil, http.StatusConflict, errors.New("an account with this email already exists; sign in with your password or verify your email first")
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		// An account holding an address nobody proved to own would block
+		// its real owner from signing up.
+		if !claims.EmailVerified {
+			return nil, http.StatusForbidden, errors.New("the identity provider has not verified your email address")
+		}
+		user, err = h.createOIDCUser(req, claims)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	default:
+		return nil, http.StatusInternalServerError, err
+	}
+
+	identity.UserID = user.ID
+	if err := h.identities.Link(ctx, identity); err != nil {
+		if isDuplicateKeyError(err) {
+			return nil, http.StatusConflict, errors.New("this identity is already linked")
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	return user, 0, nil
+}
+
+// createOIDCUser registers an account for a first-time external sign in whose
+// email the provider verified. The account gets an unusable random password;
+// the user can set one through the password reset flow.
+func (h *Handler) createOIDCUser(req *http.Request, claims *oidc.Claims) (*models.User, error) {
+	ctx := req.Context()
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	base := usernameFromClaims(claims)
+	for attempt := 0; attempt < 5; attempt++ {
+		username := base
+		if attempt > 0 {
+			n, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return nil, err
+			}
+			username = fmt.Sprintf("%s%04d", base, n.Int64())
+		}
+		user := &models.User{Username: username, Email: claims.Email, Password: password}
+		err := h.users.Create(ctx, user)
+		if isDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := h.users.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+		return user, nil
+	}
+	return nil, errors.New("could not allocate a username")
+}
+
+// usernameFromClaims derives a username from the provider's preferred
+// username or the local part of the email.
+func usernameFromClaims(claims *oidc.Claims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			b.WriteRune(r)
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
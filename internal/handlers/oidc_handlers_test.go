@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/brennanromance/heard/internal/db"
+	"github.com/brennanromance/heard/internal/mailer"
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/oidc"
+	"github.com/brennanromance/heard/internal/oidc/oidctest"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// testDB connects to the database named by HEARD_TEST_DATABASE_URL and loads
+// database_setup.sql into it, wiping whatever it held. Tests that need a
+// database are skipped when the variable is unset.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("HEARD_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("HEARD_TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	sqlDB, err := db.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	schema, err := os.ReadFile("../../database_setup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlDB.ExecContext(ctx, string(schema)); err != nil {
+		t.Fatalf("loading schema: %v", err)
+	}
+	return sqlDB
+}
+
+func newTestHandler(sqlDB *sql.DB) *Handler {
+	return NewHandler(repo.NewCompanyRepo(sqlDB), repo.NewUserRepo(sqlDB), repo.NewPostRepo(sqlDB), repo.NewCommentRepo(sqlDB),
+		repo.NewTokenRepo(sqlDB), repo.NewAffiliationRepo(sqlDB), repo.NewPseudonymRepo(sqlDB), repo.NewRoleRepo(sqlDB),
+		repo.NewUserTokenRepo(sqlDB), repo.NewMFARepo(sqlDB), repo.NewErasureRepo(sqlDB), repo.NewIdentityRepo(sqlDB),
+		repo.NewAPIKeyRepo(sqlDB), repo.NewReviewRepo(sqlDB), repo.NewCompensationRepo(sqlDB), repo.NewInterviewRepo(sqlDB),
+		repo.NewFollowRepo(sqlDB), mailer.NewMemoryMailer())
+}
+
+// oidcTest is Heard with a fake provider named "test" configured.
+type oidcTest struct {
+	h        *Handler
+	api      *httptest.Server
+	provider *oidctest.Server
+	client   *http.Client
+}
+
+func newOIDCTest(t *testing.T, h *Handler) *oidcTest {
+	t.Helper()
+	SetKeySet(mustHMACKeySet([]byte("oidc-test-secret")))
+	provider, err := oidctest.NewServer("heard", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	api := httptest.NewServer(mux)
+	t.Cleanup(api.Close)
+	h.AddOIDCProvider(oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  api.URL + "/auth/test/callback",
+	}, provider.Client()))
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	return &oidcTest{h: h, api: api, provider: provider, client: client}
+}
+
+func (o *oidcTest) get(t *testing.T, u string) *http.Response {
+	t.Helper()
+	resp, err := o.client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// login starts a sign in and returns the provider URL Heard redirected to.
+func (o *oidcTest) login(t *testing.T) *url.URL {
+	t.Helper()
+	resp := o.get(t, o.api.URL+"/auth/test/login")
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login: status %d", resp.StatusCode)
+	}
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// authorize sends the browser to the provider and returns Heard's callback
+// URL it redirects back to.
+func (o *oidcTest) authorize(t *testing.T, authURL *url.URL) string {
+	t.Helper()
+	resp := o.get(t, authURL.String())
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// signIn runs the whole flow for the provider's current user.
+func (o *oidcTest) signIn(t *testing.T) (*http.Response, AuthResponse) {
+	t.Helper()
+	resp := o.get(t, o.authorize(t, o.login(t)))
+	var body AuthResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, body
+}
+
+func createTestUser(t *testing.T, h *Handler, email string, verified bool) *models.User {
+	t.Helper()
+	ctx := context.Background()
+	u := &models.User{Username: strings.Split(email, "@")[0], Email: email, Password: "correct horse battery staple"}
+	if err := h.users.Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := h.users.MarkEmailVerified(ctx, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return u
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	// The state cookie is checked before anything is looked up, so this
+	// needs no database.
+	o := newOIDCTest(t, &Handler{})
+	callback := o.api.URL + "/auth/test/callback?code=c&state=s1"
+
+	if resp := o.get(t, callback); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("without a state cookie: status %d, want 400", resp.StatusCode)
+	}
+
+	apiURL, _ := url.Parse(o.api.URL + "/auth/")
+	o.client.Jar.SetCookies(apiURL, []*http.Cookie{{Name: oidcStateCookie, Value: "s2", Path: "/auth/"}})
+	if resp := o.get(t, callback); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("with another browser's state: status %d, want 400", resp.StatusCode)
+	}
+
+	if resp := o.get(t, o.api.URL+"/auth/other/callback?code=c&state=s2"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown provider: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestOIDCLoginRedirect(t *testing.T) {
+	o := newOIDCTest(t, newTestHandler(testDB(t)))
+	authURL := o.login(t)
+	if !strings.HasPrefix(authURL.String(), o.provider.URL+"/authorize?") {
+		t.Fatalf("redirected to %s", authURL)
+	}
+	q := authURL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Errorf("authorization request lacks PKCE or nonce: %s", q.Encode())
+	}
+	apiURL, _ := url.Parse(o.api.URL + "/auth/")
+	var state string
+	for _, c := range o.client.Jar.Cookies(apiURL) {
+		if c.Name == oidcStateCookie {
+			state = c.Value
+		}
+	}
+	if state == "" || q.Get("state") != state {
+		t.Errorf("state %q does not match the state cookie %q", q.Get("state"), state)
+	}
+
+	// A state is single use.
+	callback := o.authorize(t, authURL)
+	if resp := o.get(t, callback); resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback: status %d", resp.StatusCode)
+	}
+	o.client.Jar.SetCookies(apiURL, []*http.Cookie{{Name: oidcStateCookie, Value: state, Path: "/auth/"}})
+	if resp := o.get(t, callback); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("replayed callback: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestOIDCCallbackRejectsBadVerifier(t *testing.T) {
+	sqlDB := testDB(t)
+	o := newOIDCTest(t, newTestHandler(sqlDB))
+	callback := o.authorize(t, o.login(t))
+	if _, err := sqlDB.Exec(`UPDATE oidc_login_state SET code_verifier='not-the-verifier'`); err != nil {
+		t.Fatal(err)
+	}
+	if resp := o.get(t, callback); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	o := newOIDCTest(t, newTestHandler(testDB(t)))
+	user := createTestUser(t, o.h, "ada@example.com", true)
+	o.provider.SetUser(oidctest.User{Subject: "ada", Email: "ada@example.com", EmailVerified: true})
+
+	resp, body := o.signIn(t)
+	if resp.StatusCode != http.StatusOK || body.Token == "" {
+		t.Fatalf("status %d, token %q", resp.StatusCode, body.Token)
+	}
+	linked, err := o.h.identities.FindUser(context.Background(), "test", "ada")
+	if err != nil || linked != user.ID {
+		t.Errorf("identity linked to %d (%v), want %d", linked, err, user.ID)
+	}
+}
+
+func TestOIDCRefusesToLinkUnverifiedEmail(t *testing.T) {
+	o := newOIDCTest(t, newTestHandler(testDB(t)))
+	createTestUser(t, o.h, "ada@example.com", true)
+	createTestUser(t, o.h, "bob@example.com", false)
+
+	// The provider has not verified the address.
+	o.provider.SetUser(oidctest.User{Subject: "ada", Email: "ada@example.com", EmailVerified: false})
+	if resp, _ := o.signIn(t); resp.StatusCode != http.StatusConflict {
+		t.Errorf("unverified by the provider: status %d, want 409", resp.StatusCode)
+	}
+	// Heard has not verified the address.
+	o.provider.SetUser(oidctest.User{Subject: "bob", Email: "bob@example.com", EmailVerified: true})
+	if resp, _ := o.signIn(t); resp.StatusCode != http.StatusConflict {
+		t.Errorf("unverified by Heard: status %d, want 409", resp.StatusCode)
+	}
+	for _, sub := range []string{"ada", "bob"} {
+		if _, err := o.h.identities.FindUser(context.Background(), "test", sub); err != sql.ErrNoRows {
+			t.Errorf("identity %s was linked (%v)", sub, err)
+		}
+	}
+}
+
+func TestOIDCCreatesUser(t *testing.T) {
+	o := newOIDCTest(t, newTestHandler(testDB(t)))
+	ctx := context.Background()
+
+	o.provider.SetUser(oidctest.User{Subject: "eve", Email: "eve@example.com", EmailVerified: false})
+	if resp, _ := o.signIn(t); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unverified email: status %d, want 403", resp.StatusCode)
+	}
+	if _, err := o.h.users.GetByEmail(ctx, "eve@example.com"); err != sql.ErrNoRows {
+		t.Errorf("an account was created for an unverified email (%v)", err)
+	}
+
+	o.provider.SetUser(oidctest.User{Subject: "carol", Email: "carol@example.com", EmailVerified: true})
+	resp, body := o.signIn(t)
+	if resp.StatusCode != http.StatusOK || body.Token == "" || body.User == nil {
+		t.Fatalf("status %d, body %+v", resp.StatusCode, body)
+	}
+	user, err := o.h.users.GetByEmail(ctx, "carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != body.User.ID || user.Username != "carol" || !user.EmailVerified {
+		t.Errorf("created %+v, signed in as %+v", user, body.User)
+	}
+
+	// Signing in again uses the linked identity.
+	_, again := o.signIn(t)
+	if again.User == nil || again.User.ID != user.ID {
+		t.Errorf("second sign in as %+v, want user %d", again.User, user.ID)
+	}
+}
+
+func TestOIDCHandsOffToMFA(t *testing.T) {
+	sqlDB := testDB(t)
+	o := newOIDCTest(t, newTestHandler(sqlDB))
+	user := createTestUser(t, o.h, "ada@example.com", true)
+	if _, err := sqlDB.Exec(`UPDATE users SET totp_secret='JBSWY3DPEHPK3PXP', totp_enabled=true WHERE id=$1`, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	o.provider.SetUser(oidctest.User{Subject: "ada", Email: "ada@example.com", EmailVerified: true})
+
+	resp, body := o.signIn(t)
+	if resp.StatusCode != http.StatusOK || !body.MFARequired || body.Token != "" || body.RefreshToken != "" {
+		t.Fatalf("status %d, body %+v", resp.StatusCode, body)
+	}
+	if id, err := validateMFAToken(body.MFAToken); err != nil || id != user.ID {
+		t.Errorf("mfa token for user %d (%v), want %d", id, err, user.ID)
+	}
+}
+
+func TestOIDCUserIsPointedAtPasswordReset(t *testing.T) {
+	o := newOIDCTest(t, newTestHandler(testDB(t)))
+	o.provider.SetUser(oidctest.User{Subject: "carol", Email: "carol@example.com", EmailVerified: true})
+	resp, body := o.signIn(t)
+	if resp.StatusCode != http.StatusOK || body.Token == "" {
+		t.Fatalf("status %d, body %+v", resp.StatusCode, body)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, o.api.URL+"/me", strings.NewReader(`{"password": "a guess"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+body.Token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(msg), "/password/forgot") {
+		t.Errorf("status %d, body %q; want 401 pointing at /password/forgot", resp.StatusCode, msg)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// pageResponse is the envelope paginated list endpoints answer with.
+// NextCursor is omitted on the last page.
+type pageResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// pageFromQuery reads the limit and cursor parameters of a list request.
+func pageFromQuery(req *http.Request) (repo.Page, error) {
+	q := req.URL.Query()
+	p := repo.Page{Cursor: q.Get("cursor")}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > repo.MaxPageSize {
+			return p, fmt.Errorf("limit must be between 1 and %d", repo.MaxPageSize)
+		}
+		p.Limit = n
+	}
+	return p, nil
+}
+
+// writeListError reports a failed list call, blaming the client for cursors
+// that don't decode or belong to another ordering.
+func writeListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repo.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
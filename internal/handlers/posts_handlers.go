@@ -1,29 +1,78 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
 )
 
 func (h *Handler) postsHandlerGET(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	if id, ok := idFromQuery(req); ok {
 		p, err := h.posts.GetByID(ctx, id)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if err := h.markLikedPosts(ctx, claims, p); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redactPost(p, claims)
 		writeJSON(w, p, http.StatusOK)
 		return
 	}
-	list, err := h.posts.List(ctx)
+	page, err := pageFromQuery(req)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := postFilterFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.posts.List(ctx, filter, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if err := h.markLikedPosts(ctx, claims, list...); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, list, http.StatusOK)
+	for _, p := range list {
+		redactPost(p, claims)
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+// postFilterFromQuery reads company_id and include_subsidiaries, which rolls
+// posts about subsidiaries up into the parent company's feed.
+func postFilterFromQuery(req *http.Request) (repo.PostFilter, error) {
+	q := req.URL.Query()
+	var f repo.PostFilter
+	if v := q.Get("company_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return f, errors.New("company_id must be an integer")
+		}
+		f.CompanyID = id
+	}
+	rollup, err := includeSubsidiaries(req)
+	f.IncludeSubsidiaries = rollup
+	return f, err
 }
 
 func (h *Handler) postsHandlerPOST(w http.ResponseWriter, req *http.Request) {
@@ -42,13 +91,28 @@ func (h *Handler) postsHandlerPOST(w http.ResponseWriter, req *http.Request) {
 	}
 	p.UserID = claims.UserID
 
-	// Reset likes to 0 (cannot be set by client)
-	p.Likes = 0
+	// Anonymous posts are shown under the author's pseudonym for the company
+	if p.Anonymous {
+		if p.CompanyID == nil {
+			http.Error(w, "anonymous posts require a company_id", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.pseudonymFor(ctx, claims.UserID, *p.CompanyID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if err := h.posts.Create(ctx, &p); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, p, http.StatusCreated)
+	created, err := h.posts.GetByID(ctx, p.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, created, http.StatusCreated)
 }
 
 type likePostRequest struct {
@@ -71,12 +135,37 @@ func (h *Handler) likePostHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
-	liked, err := h.posts.ToggleLike(ctx, claims.UserID, r.PostID)
+	liked, likes, err := h.posts.ToggleLike(ctx, claims.UserID, r.PostID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "post not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
-	writeJSON(w, map[string]bool{"liked": liked}, http.StatusOK)
+	writeJSON(w, likeResponse{Liked: liked, Likes: likes}, http.StatusOK)
+}
+
+type likeResponse struct {
+	Liked bool `json:"liked"`
+	Likes int  `json:"likes"`
+}
+
+// markLikedPosts sets LikedByMe on posts the caller has liked.
+func (h *Handler) markLikedPosts(ctx context.Context, claims *Claims, posts ...*models.Post) error {
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	liked, err := h.posts.LikedBy(ctx, claims.UserID, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.LikedByMe = liked[p.ID]
+	}
+	return nil
 }
 
 func (h *Handler) postsHandlerPUT(w http.ResponseWriter, req *http.Request) {
@@ -86,20 +175,14 @@ func (h *Handler) postsHandlerPUT(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	// Get the post to verify ownership
+	// Get the post to verify the caller may edit it
 	existing, err := h.posts.GetByID(ctx, id)
 	if err != nil {
 		http.Error(w, "post not found", http.StatusNotFound)
 		return
 	}
-	// Verify the user owns this post
-	claims, err := GetUserClaimsFromContext(ctx)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	if existing.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	claims, ok := authorize(w, req, PermEditPost, Resource{OwnerID: &existing.UserID})
+	if !ok {
 		return
 	}
 	var p models.Post
@@ -108,12 +191,40 @@ func (h *Handler) postsHandlerPUT(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	p.ID = id
-	p.UserID = claims.UserID
+	// The author never changes, even when a moderator edits the post
+	p.UserID = existing.UserID
+	// Only the author may reveal themselves or move the post to another
+	// company; moderators unmask authors through the audited
+	// de-anonymization endpoint.
+	if claims.UserID != existing.UserID {
+		p.Anonymous = existing.Anonymous
+		p.CompanyID = existing.CompanyID
+	}
+	if p.Anonymous {
+		if p.CompanyID == nil {
+			http.Error(w, "anonymous posts require a company_id", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.pseudonymFor(ctx, p.UserID, *p.CompanyID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	if err := h.posts.Update(ctx, &p); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, p, http.StatusOK)
+	updated, err := h.posts.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.markLikedPosts(ctx, claims, updated); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redactPost(updated, claims)
+	writeJSON(w, updated, http.StatusOK)
 }
 
 func (h *Handler) postsHandlerDELETE(w http.ResponseWriter, req *http.Request) {
@@ -123,20 +234,13 @@ func (h *Handler) postsHandlerDELETE(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	// Get the post to verify ownership
+	// Get the post to verify the caller may delete it
 	existing, err := h.posts.GetByID(ctx, id)
 	if err != nil {
 		http.Error(w, "post not found", http.StatusNotFound)
 		return
 	}
-	// Verify the user owns this post
-	claims, err := GetUserClaimsFromContext(ctx)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	if existing.UserID != claims.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := authorize(w, req, PermDeletePost, Resource{OwnerID: &existing.UserID}); !ok {
 		return
 	}
 	if err := h.posts.Delete(ctx, id); err != nil {
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+var pseudonymAdjectives = []string{
+	"Amber", "Brave", "Calm", "Clever", "Curious", "Daring", "Eager", "Gentle",
+	"Honest", "Jolly", "Keen", "Lucky", "Mellow", "Nimble", "Patient", "Quiet",
+	"Rapid", "Silent", "Steady", "Swift", "Tidy", "Vivid", "Witty", "Zesty",
+}
+
+var pseudonymNouns = []string{
+	"Badger", "Beaver", "Crane", "Falcon", "Ferret", "Fox", "Heron", "Ibis",
+	"Koala", "Lynx", "Marmot", "Moose", "Otter", "Owl", "Panda", "Puffin",
+	"Raven", "Robin", "Seal", "Sparrow", "Stoat", "Tapir", "Walrus", "Yak",
+}
+
+func randomIndex(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(i.Int64())
+}
+
+func randomPseudonym(withNumber bool) string {
+	name := pseudonymAdjectives[randomIndex(len(pseudonymAdjectives))] + " " + pseudonymNouns[randomIndex(len(pseudonymNouns))]
+	if withNumber {
+		name = fmt.Sprintf("%s %d", name, 10+randomIndex(990))
+	}
+	return name
+}
+
+// pseudonymFor returns the user's stable pseudonym for a company, creating one
+// the first time they post anonymously about it.
+func (h *Handler) pseudonymFor(ctx context.Context, userID, companyID int) (*models.Pseudonym, error) {
+	if p, err := h.pseudonyms.Get(ctx, userID, companyID); err == nil {
+		return p, nil
+	}
+	for attempt := 0; attempt < 10; attempt++ {
+		p := &models.Pseudonym{UserID: userID, CompanyID: companyID, Name: randomPseudonym(attempt >= 3)}
+		err := h.pseudonyms.Create(ctx, p)
+		if errors.Is(err, repo.ErrPseudonymTaken) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, errors.New("could not allocate a pseudonym")
+}
+
+// redactPost hides the author of an anonymous post, or of one whose author
+// erased their account, from everyone but the author.
+func redactPost(p *models.Post, claims *Claims) {
+	if (p.Anonymous || p.AuthorDeleted) && p.UserID != claims.UserID {
+		p.UserID = 0
+	}
+}
+
+// redactComment hides the author of an anonymous comment, or of one whose
+// author erased their account, from everyone but the author.
+func redactComment(c *models.Comment, claims *Claims) {
+	if (c.Anonymous || c.AuthorDeleted) && c.UserID != claims.UserID {
+		c.UserID = 0
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// companyRatingsHandler returns the aggregate scores of a company,
+// optionally rolled up with its subsidiaries.
+func (h *Handler) companyRatingsHandler(w http.ResponseWriter, req *http.Request) {
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	rollup, err := includeSubsidiaries(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := h.reviews.Summary(req.Context(), c.ID, rollup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, s, http.StatusOK)
+}
+
+func (h *Handler) reviewsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	rollup, err := includeSubsidiaries(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.reviews.ListForCompany(ctx, c.ID, rollup, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	kind := h.reviewKind()
+	for _, rv := range list {
+		kind.redact(rv, claims)
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+func (h *Handler) reviewsHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c, ok := h.companyFromPath(w, req)
+	if !ok {
+		return
+	}
+	var rv models.Review
+	if err := json.NewDecoder(req.Body).Decode(&rv); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	rv.CompanyID = c.ID
+	rv.UserID = claims.UserID
+	if errs := reviewErrors(&rv); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if _, err := h.pseudonymFor(ctx, claims.UserID, c.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.reviews.Create(ctx, &rv); err != nil {
+		if errors.Is(err, repo.ErrReviewExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	created, err := h.reviews.GetByID(ctx, rv.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, created, http.StatusCreated)
+}
+
+// reviewKind loads, authorizes and redacts reviews.
+func (h *Handler) reviewKind() authored[*models.Review] {
+	return authored[*models.Review]{
+		noun:   "review",
+		get:    h.reviews.GetByID,
+		author: func(v *models.Review) *int { return &v.UserID },
+	}
+}
+
+func (h *Handler) reviewHandlerGET(w http.ResponseWriter, req *http.Request) {
+	h.reviewKind().serveGET(w, req)
+}
+
+// reviewHandlerPATCH updates the fields present in the body. Only the author
+// may edit a review.
+func (h *Handler) reviewHandlerPATCH(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	existing, ok := h.reviewKind().authorized(w, req, PermEditReview)
+	if !ok {
+		return
+	}
+	rv := *existing
+	if err := json.NewDecoder(req.Body).Decode(&rv); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	rv.ID, rv.CompanyID, rv.UserID, rv.Year = existing.ID, existing.CompanyID, existing.UserID, existing.Year
+	if errs := reviewErrors(&rv); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if err := h.reviews.Update(ctx, &rv); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated, err := h.reviews.GetByID(ctx, rv.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, updated, http.StatusOK)
+}
+
+func (h *Handler) reviewHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	existing, ok := h.reviewKind().authorized(w, req, PermDeleteReview)
+	if !ok {
+		return
+	}
+	if err := h.reviews.Delete(req.Context(), existing.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reviewErrors validates the scores and text of a review, trimming the text
+// fields in place.
+func reviewErrors(rv *models.Review) []FieldError {
+	var errs []FieldError
+	if rv.Overall < 1 || rv.Overall > 5 {
+		errs = append(errs, FieldError{Field: "overall", Code: "out_of_range", Message: "overall must be between 1 and 5"})
+	}
+	for _, s := range []struct {
+		field string
+		score *int
+	}{
+		{"compensation", rv.Compensation},
+		{"work_life_balance", rv.WorkLifeBalance},
+		{"management", rv.Management},
+		{"culture", rv.Culture},
+		{"career_growth", rv.CareerGrowth},
+	} {
+		if s.score != nil && (*s.score < 1 || *s.score > 5) {
+			errs = append(errs, FieldError{Field: s.field, Code: "out_of_range", Message: s.field + " must be between 1 and 5"})
+		}
+	}
+	rv.Pros = strings.TrimSpace(rv.Pros)
+	rv.Cons = strings.TrimSpace(rv.Cons)
+	if rv.Pros == "" {
+		errs = append(errs, FieldError{Field: "pros", Code: "required", Message: "pros is required"})
+	}
+	if rv.Cons == "" {
+		errs = append(errs, FieldError{Field: "cons", Code: "required", Message: "cons is required"})
+	}
+	if rv.JobTitle != nil {
+		t := strings.TrimSpace(*rv.JobTitle)
+		switch {
+		case t == "":
+			rv.JobTitle = nil
+		case len(t) > 255:
+			errs = append(errs, FieldError{Field: "job_title", Code: "too_long", Message: "job_title must be at most 255 characters"})
+		default:
+			rv.JobTitle = &t
+		}
+	}
+	if rv.EmploymentStatus != models.EmploymentCurrent && rv.EmploymentStatus != models.EmploymentFormer {
+		errs = append(errs, FieldError{Field: "employment_status", Code: "invalid", Message: "employment_status must be current or former"})
+	}
+	if rv.TenureYears != nil && *rv.TenureYears < 0 {
+		errs = append(errs, FieldError{Field: "tenure_years", Code: "out_of_range", Message: "tenure_years cannot be negative"})
+	}
+	return errs
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+type userRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type companyRoleRequest struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// accessToken signs an access token for user in session sid, embedding the
+// user's current site-wide and company roles.
+func (h *Handler) accessToken(ctx context.Context, user *models.User, sid string) (string, error) {
+	roles, err := h.roles.CompanyRolesForUser(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	user.CompanyRoles = roles
+	return GenerateToken(user, sid)
+}
+
+func validUserRole(role string) bool {
+	switch role {
+	case models.RoleUser, models.RoleModerator, models.RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func validCompanyRole(role string) bool {
+	return role == models.CompanyRoleAdmin
+}
+
+// usersHandlerGET pages through every active account. Admin only.
+func (h *Handler) usersHandlerGET(w http.ResponseWriter, req *http.Request) {
+	if _, ok := authorize(w, req, PermManageUserRoles, Resource{}); !ok {
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.users.List(req.Context(), page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+// userRoleHandlerPUT changes a user's site-wide role. Admin only.
+func (h *Handler) userRoleHandlerPUT(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	if _, ok := authorize(w, req, PermManageUserRoles, Resource{}); !ok {
+		return
+	}
+	var r userRoleRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validUserRole(r.Role) {
+		http.Error(w, "role must be user, moderator or admin", http.StatusBadRequest)
+		return
+	}
+	if err := h.roles.SetUserRole(ctx, id, r.Role); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, map[string]interface{}{"user_id": id, "role": r.Role}, http.StatusOK)
+}
+
+func (h *Handler) companyRolesHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := authorize(w, req, PermManageCompanyRoles, companyResource(existing)); !ok {
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.roles.ListCompanyRoles(ctx, id, page)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
+
+func (h *Handler) companyRolesHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := authorize(w, req, PermManageCompanyRoles, companyResource(existing)); !ok {
+		return
+	}
+	var r companyRoleRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validCompanyRole(r.Role) {
+		http.Error(w, "role must be company_admin", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.users.GetByID(ctx, r.UserID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	cr := models.CompanyRole{UserID: r.UserID, CompanyID: id, Role: r.Role}
+	if err := h.roles.GrantCompanyRole(ctx, &cr); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, cr, http.StatusCreated)
+}
+
+func (h *Handler) companyRolesHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id, ok := idFromQuery(req)
+	if !ok {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.Atoi(req.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "missing user_id", http.StatusBadRequest)
+		return
+	}
+	role := req.URL.Query().Get("role")
+	if role == "" {
+		role = models.CompanyRoleAdmin
+	}
+	existing, err := h.companies.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "company not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := authorize(w, req, PermManageCompanyRoles, companyResource(existing)); !ok {
+		return
+	}
+	if err := h.roles.RevokeCompanyRole(ctx, userID, id, role); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+// Scope limits what an API key may do on behalf of its user. Session tokens
+// are not scoped.
+type Scope string
+
+const (
+	ScopeRead            Scope = "read"
+	ScopePostsWrite      Scope = "posts:write"
+	ScopeCommentsWrite   Scope = "comments:write"
+	ScopeCompaniesWrite  Scope = "companies:write"
+	ScopeReviewsWrite    Scope = "reviews:write"
+	ScopeInterviewsWrite Scope = "interviews:write"
+)
+
+var knownScopes = map[Scope]bool{
+	ScopeRead:            true,
+	ScopePostsWrite:      true,
+	ScopeCommentsWrite:   true,
+	ScopeCompaniesWrite:  true,
+	ScopeReviewsWrite:    true,
+	ScopeInterviewsWrite: true,
+}
+
+// routeScopes lists the routes API keys may call and the scope each needs,
+// keyed by the ServeMux pattern. Routes missing here (account settings, key
+// management, moderation, ...) require a session token.
+var routeScopes = map[string]Scope{
+	"GET /me":                                ScopeRead,
+	"GET /users/{username}":                  ScopeRead,
+	"GET /companies":                         ScopeRead,
+	"GET /companies/export":                  ScopeRead,
+	"GET /companies/domains":                 ScopeRead,
+	"GET /companies/roles":                   ScopeRead,
+	"GET /companies/resolve":                 ScopeRead,
+	"GET /companies/{id}/subsidiaries":       ScopeRead,
+	"GET /companies/{id}/ancestors":          ScopeRead,
+	"GET /companies/{id}/aliases":            ScopeRead,
+	"GET /companies/{id}/tickers":            ScopeRead,
+	"GET /companies/{id}/ratings":            ScopeRead,
+	"GET /companies/{id}/reviews":            ScopeRead,
+	"GET /reviews/{id}":                      ScopeRead,
+	"GET /companies/{id}/interviews":         ScopeRead,
+	"GET /companies/{id}/interviews/summary": ScopeRead,
+	"GET /interviews/{id}":                   ScopeRead,
+	"GET /compensation":                      ScopeRead,
+	"GET /feed":                              ScopeRead,
+	"GET /search":                            ScopeRead,
+	"GET /me/follows":                        ScopeRead,
+	"GET /posts":                             ScopeRead,
+	"GET /comments":                          ScopeRead,
+
+	"POST /posts":    ScopePostsWrite,
+	"PUT /posts":     ScopePostsWrite,
+	"DELETE /posts":  ScopePostsWrite,
+	"POST /likepost": ScopePostsWrite,
+
+	"POST /comments":    ScopeCommentsWrite,
+	"PUT /comments":     ScopeCommentsWrite,
+	"DELETE /comments":  ScopeCommentsWrite,
+	"POST /likecomment": ScopeCommentsWrite,
+
+	"POST /companies":                          ScopeCompaniesWrite,
+	"PATCH /companies":                         ScopeCompaniesWrite,
+	"DELETE /companies":                        ScopeCompaniesWrite,
+	"POST /companies/{id}/aliases":             ScopeCompaniesWrite,
+	"DELETE /companies/{id}/aliases/{name_id}": ScopeCompaniesWrite,
+	"POST /companies/{id}/tickers":             ScopeCompaniesWrite,
+	"DELETE /companies/{id}/tickers/{name_id}": ScopeCompaniesWrite,
+
+	"POST /companies/{id}/reviews": ScopeReviewsWrite,
+	"PATCH /reviews/{id}":          ScopeReviewsWrite,
+	"DELETE /reviews/{id}":         ScopeReviewsWrite,
+
+	"POST /companies/{id}/interviews": ScopeInterviewsWrite,
+	"PATCH /interviews/{id}":          ScopeInterviewsWrite,
+	"DELETE /interviews/{id}":         ScopeInterviewsWrite,
+}
+
+// HasScope reports whether the credential may use scope. Claims from a
+// session token carry no scopes and may do everything.
+func (c *Claims) HasScope(scope Scope) bool {
+	if c.APIKeyID == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if Scope(s) == scope {
+			return true
+		}
+	}
+	return false
+}
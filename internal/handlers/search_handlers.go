@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+// searchFilterFromQuery reads q, the post filters and industry, after and
+// before from the query string.
+func searchFilterFromQuery(req *http.Request) (repo.SearchFilter, error) {
+	q := req.URL.Query()
+	pf, err := postFilterFromQuery(req)
+	f := repo.SearchFilter{PostFilter: pf, Query: q.Get("q"), Industry: q.Get("industry")}
+	if err != nil {
+		return f, err
+	}
+	if f.Query == "" {
+		return f, errors.New("q is required")
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"after", &f.After},
+		{"before", &f.Before},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return f, fmt.Errorf("%s must be a date in YYYY-MM-DD format", p.name)
+		}
+		*p.dst = &t
+	}
+	return f, nil
+}
+
+// searchHandler runs a full-text search over posts and their comments and
+// returns the matching posts, most relevant first, with highlighted snippets.
+func (h *Handler) searchHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filter, err := searchFilterFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, next, err := h.posts.Search(ctx, filter, page)
+	if errors.Is(err, repo.ErrEmptySearch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	posts := make([]*models.Post, len(list))
+	for i, res := range list {
+		posts[i] = res.Post
+	}
+	if err := h.markLikedPosts(ctx, claims, posts...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, p := range posts {
+		redactPost(p, claims)
+	}
+	writeJSON(w, pageResponse{Data: list, NextCursor: next}, http.StatusOK)
+}
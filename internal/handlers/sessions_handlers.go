@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxUserAgentLen caps the user agent stored with a session.
+const maxUserAgentLen = 512
+
+// userAgent returns the request's user agent as text Postgres accepts: valid
+// UTF-8 without NUL bytes, cut on a rune boundary.
+func userAgent(req *http.Request) string {
+	ua := strings.ReplaceAll(strings.ToValidUTF8(req.UserAgent(), "\uFFFD"), "\x00", "")
+	if len(ua) > maxUserAgentLen {
+		cut := maxUserAgentLen
+		for cut > 0 && !utf8.RuneStart(ua[cut]) {
+			cut--
+		}
+		ua = ua[:cut]
+	}
+	return ua
+}
+
+// sessionsHandlerGET lists where the user is signed in.
+func (h *Handler) sessionsHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	list, err := h.tokens.ListActiveSessions(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, s := range list {
+		s.Current = s.ID == claims.SessionID
+	}
+	writeJSON(w, list, http.StatusOK)
+}
+
+// sessionsHandlerDELETE signs out one session. Its refresh token stops working
+// and access tokens issued for it are rejected by AuthMiddleware.
+func (h *Handler) sessionsHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.tokens.RevokeUserSession(ctx, claims.UserID, req.PathValue("id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUserAgent(t *testing.T) {
+	for _, tt := range []struct {
+		name, ua, want string
+	}{
+		{"plain", "curl/8.0", "curl/8.0"},
+		{"invalid utf-8", "curl\xff/8.0", "curl�/8.0"},
+		{"nul", "curl\x00/8.0", "curl/8.0"},
+		{"long", strings.Repeat("a", maxUserAgentLen+10), strings.Repeat("a", maxUserAgentLen)},
+		{"split rune", strings.Repeat("a", maxUserAgentLen-1) + "é", strings.Repeat("a", maxUserAgentLen-1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/login", nil)
+			req.Header.Set("User-Agent", tt.ua)
+			got := userAgent(req)
+			if got != tt.want {
+				t.Errorf("userAgent = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("userAgent = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+type updateMeRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	// CurrentPassword is required to change the email.
+	CurrentPassword string `json:"current_password"`
+}
+
+// maxUsernameLength matches users.username.
+const maxUsernameLength = 50
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type deleteMeRequest struct {
+	Password string `json:"password"`
+}
+
+// meHandlerGET returns the authenticated user's own account.
+func (h *Handler) meHandlerGET(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	user.Password = ""
+	if user.CompanyRoles, err = h.roles.CompanyRolesForUser(ctx, user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, user, http.StatusOK)
+}
+
+// userProfileHandlerGET returns the public profile for a username.
+func (h *Handler) userProfileHandlerGET(w http.ResponseWriter, req *http.Request) {
+	user, err := h.users.GetByUsername(req.Context(), req.PathValue("username"))
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, models.PublicProfile{ID: user.ID, Username: user.Username, Role: user.Role}, http.StatusOK)
+}
+
+// meHandlerPATCH changes the username and/or email. Changing the email needs
+// the current password, so a stolen access token cannot take over the account
+// through a password reset; it also cancels pending resets, signs out every
+// other session and notifies the old address. A new email has to be verified
+// again. Tokens already issued keep the old values until refreshed.
+func (h *Handler) meHandlerPATCH(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r updateMeRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	user, err := h.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	oldEmail := user.Email
+	if r.Username != nil {
+		user.Username = strings.TrimSpace(*r.Username)
+		if user.Username == "" {
+			http.Error(w, "username must not be empty", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(user.Username) > maxUsernameLength {
+			http.Error(w, fmt.Sprintf("username must be at most %d characters", maxUsernameLength), http.StatusBadRequest)
+			return
+		}
+	}
+	if r.Email != nil {
+		user.Email = strings.TrimSpace(*r.Email)
+		if !strings.Contains(user.Email, "@") {
+			http.Error(w, "invalid email", http.StatusBadRequest)
+			return
+		}
+	}
+	emailChanged := user.Email != oldEmail
+	if emailChanged {
+		if r.CurrentPassword == "" {
+			http.Error(w, "current_password is required to change the email", http.StatusBadRequest)
+			return
+		}
+		if err := h.users.VerifyPassword(ctx, user.ID, r.CurrentPassword); err != nil {
+			h.rejectPassword(w, req, user.ID)
+			return
+		}
+	}
+	if err := h.users.Update(ctx, user); err != nil {
+		if isDuplicateKeyError(err) {
+			http.Error(w, "username or email already taken", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if emailChanged {
+		if err := h.userTokens.Revoke(ctx, user.ID, models.TokenPurposePasswordReset); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := h.tokens.RevokeOtherSessions(ctx, user.ID, claims.SessionID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := h.sendEmailChangedNotice(ctx, user, oldEmail); err != nil {
+			log.Printf("email change notice for user %d: %v", user.ID, err)
+		}
+		if err := h.sendVerificationEmail(ctx, user); err != nil {
+			log.Printf("verification email for user %d: %v", user.ID, err)
+		}
+	}
+	user.Password = ""
+	writeJSON(w, user, http.StatusOK)
+}
+
+// rejectPassword answers a failed password re-check. Accounts created by an
+// external sign in start with a random password nobody knows, so their owners
+// are pointed at the reset flow.
+func (h *Handler) rejectPassword(w http.ResponseWriter, req *http.Request, userID int) {
+	msg := "invalid password"
+	if ids, err := h.identities.ListForUser(req.Context(), userID); err == nil && len(ids) > 0 {
+		msg += "; if you sign in with " + ids[0].Provider + ", set a password first through POST /password/forgot"
+	}
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+// changePasswordHandler sets a new password after re-checking the current one
+// and signs out every other session.
+func (h *Handler) changePasswordHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r changePasswordRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.NewPassword == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.users.VerifyPassword(ctx, claims.UserID, r.CurrentPassword); err != nil {
+		h.rejectPassword(w, req, claims.UserID)
+		return
+	}
+	if !h.checkPassword(w, "new_password", r.NewPassword, claims.Username, claims.Email) {
+		return
+	}
+	if err := h.users.SetPassword(ctx, claims.UserID, r.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.tokens.RevokeOtherSessions(ctx, claims.UserID, claims.SessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "password changed"}, http.StatusOK)
+}
+
+// meHandlerDELETE queues the erasure of the account after re-checking the
+// password. The account is signed out immediately; progress can be followed
+// at /erasure-requests/{id}.
+func (h *Handler) meHandlerDELETE(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var r deleteMeRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.users.VerifyPassword(ctx, claims.UserID, r.Password); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		h.rejectPassword(w, req, claims.UserID)
+		return
+	}
+	id, err := randomToken(24)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	e := &models.ErasureRequest{ID: id, UserID: claims.UserID}
+	if err := h.erasures.Create(ctx, e); err != nil {
+		if errors.Is(err, repo.ErrErasureInProgress) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, e, http.StatusAccepted)
+}
+
+// erasureStatusHandler reports the progress of an erasure request. It needs no
+// authentication because the account is signed out once erasure is requested.
+func (h *Handler) erasureStatusHandler(w http.ResponseWriter, req *http.Request) {
+	e, err := h.erasures.Get(req.Context(), req.PathValue("id"))
+	if err != nil {
+		http.Error(w, "erasure request not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, e, http.StatusOK)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brennanromance/heard/internal/password"
+)
+
+// FieldError is one entry in a 422 response body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type validationErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// writeValidationErrors answers 422 with machine-readable reasons.
+func writeValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	writeJSON(w, validationErrorResponse{Error: "validation failed", Fields: errs}, http.StatusUnprocessableEntity)
+}
+
+// SetPasswordPolicy replaces the rules new passwords are checked against.
+func (h *Handler) SetPasswordPolicy(p *password.Policy) { h.passwords = p }
+
+// passwordErrors checks pw against the policy, reporting violations under
+// field. personal holds the user's username and email.
+func (h *Handler) passwordErrors(field, pw string, personal ...string) ([]FieldError, error) {
+	violations, err := h.passwords.Check(pw, personal...)
+	if err != nil {
+		return nil, err
+	}
+	var out []FieldError
+	for _, v := range violations {
+		out = append(out, FieldError{Field: field, Code: v.Code, Message: v.Message})
+	}
+	return out, nil
+}
+
+// checkPassword writes a 422 (or 500) and returns false when pw is not
+// acceptable.
+func (h *Handler) checkPassword(w http.ResponseWriter, field, pw string, personal ...string) bool {
+	errs, err := h.passwordErrors(field, pw, personal...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+	return true
+}
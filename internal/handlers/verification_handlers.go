@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/brennanromance/heard/internal/mailer"
+	"github.com/brennanromance/heard/internal/models"
+	"github.com/brennanromance/heard/internal/repo"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+type tokenRequest struct {
+	Token string `json:"token"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// SetAppURL sets the base URL of the web app used to build links in emails.
+func (h *Handler) SetAppURL(u string) { h.appURL = u }
+
+// mailToken issues a single-use token for purpose and mails it to the user.
+func (h *Handler) mailToken(ctx context.Context, user *models.User, purpose string, ttl time.Duration, subject, path, intro string) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := h.userTokens.Create(ctx, user.ID, purpose, hashToken(token), time.Now().Add(ttl)); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Hi %s,\n\n%s\n\nToken: %s\n", user.Username, intro, token)
+	if h.appURL != "" {
+		body += fmt.Sprintf("\nOr open %s%s?token=%s\n", h.appURL, path, url.QueryEscape(token))
+	}
+	body += fmt.Sprintf("\nThis token expires in %s.\n", ttl)
+	return h.mailer.Send(ctx, mailer.Message{To: user.Email, Subject: subject, Body: body})
+}
+
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	return h.mailToken(ctx, user, models.TokenPurposeEmailVerification, emailVerificationTTL,
+		"Verify your Heard email address", "/verify-email",
+		"Please confirm your email address for Heard.")
+}
+
+// sendEmailChangedNotice tells the previous address that the account's email
+// was changed, so its owner notices if someone else did it.
+func (h *Handler) sendEmailChangedNotice(ctx context.Context, user *models.User, oldEmail string) error {
+	body := fmt.Sprintf("Hi %s,\n\nThe email address of your Heard account was changed to %s. "+
+		"If you did not make this change, contact support right away.\n", user.Username, user.Email)
+	return h.mailer.Send(ctx, mailer.Message{To: oldEmail, Subject: "Your Heard email address was changed", Body: body})
+}
+
+func (h *Handler) verifyEmailHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var r tokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.Token == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	userID, err := h.userTokens.Consume(ctx, models.TokenPurposeEmailVerification, hashToken(r.Token))
+	if errors.Is(err, repo.ErrUserTokenInvalid) {
+		http.Error(w, "invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.users.MarkEmailVerified(ctx, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "email verified"}, http.StatusOK)
+}
+
+func (h *Handler) resendVerificationHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	claims, err := GetUserClaimsFromContext(ctx)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "email already verified", http.StatusConflict)
+		return
+	}
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		http.Error(w, "failed to send verification email", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "verification email sent"}, http.StatusAccepted)
+}
+
+// forgotPasswordHandler mails a reset token. It answers the same way whether
+// or not the email belongs to an account so it can't be used to probe for
+// users.
+func (h *Handler) forgotPasswordHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var r forgotPasswordRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.Email == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if user, err := h.users.GetByEmail(ctx, r.Email); err == nil {
+		err := h.mailToken(ctx, user, models.TokenPurposePasswordReset, passwordResetTTL,
+			"Reset your Heard password", "/reset-password",
+			"Someone asked to reset the password for your Heard account. If it wasn't you, ignore this email.")
+		if err != nil {
+			log.Printf("password reset email for user %d: %v", user.ID, err)
+		}
+	}
+	writeJSON(w, map[string]string{"message": "if the account exists, a reset email has been sent"}, http.StatusAccepted)
+}
+
+func (h *Handler) resetPasswordHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var r resetPasswordRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.Token == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	// Check the new password before the token is used up so a rejected
+	// password can be retried with the same link
+	userID, err := h.userTokens.Lookup(ctx, models.TokenPurposePasswordReset, hashToken(r.Token))
+	if errors.Is(err, repo.ErrUserTokenInvalid) {
+		http.Error(w, "invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := h.users.GetByID(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPassword(w, "password", r.Password, user.Username, user.Email) {
+		return
+	}
+	if _, err := h.userTokens.Consume(ctx, models.TokenPurposePasswordReset, hashToken(r.Token)); err != nil {
+		if errors.Is(err, repo.ErrUserTokenInvalid) {
+			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.users.SetPassword(ctx, userID, r.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Receiving the reset email proves control of the address
+	if err := h.users.MarkEmailVerified(ctx, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Sign out everywhere: whoever knew the old password loses access
+	if err := h.tokens.RevokeAllSessions(ctx, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "password has been reset"}, http.StatusOK)
+}
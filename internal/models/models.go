@@ -12,32 +12,412 @@ type Company struct {
 	Headquarters     *string `json:"headquarters,omitempty"`
 	DateIncorporated *string `json:"date_incorporated,omitempty"`
 	UserID           *int    `json:"user_id,omitempty"`
+	// Ratings aggregates the company's reviews and is ignored on writes.
+	Ratings RatingSummary `json:"ratings"`
 }
 
+// RatingSummary averages review scores. An average is nil when no review
+// rated that aspect.
+type RatingSummary struct {
+	Count           int      `json:"count"`
+	Overall         *float64 `json:"overall"`
+	Compensation    *float64 `json:"compensation"`
+	WorkLifeBalance *float64 `json:"work_life_balance"`
+	Management      *float64 `json:"management"`
+	Culture         *float64 `json:"culture"`
+	CareerGrowth    *float64 `json:"career_growth"`
+}
+
+// CompanyNode is a company together with the companies it owns.
+type CompanyNode struct {
+	Company
+	Subsidiaries []*CompanyNode `json:"subsidiaries"`
+}
+
+// CompanyAlias is another name a company is known by.
+type CompanyAlias struct {
+	ID        int       `json:"id"`
+	CompanyID int       `json:"company_id"`
+	Alias     string    `json:"alias"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CompanyTicker is a stock symbol a company trades under.
+type CompanyTicker struct {
+	ID        int       `json:"id"`
+	CompanyID int       `json:"company_id"`
+	Symbol    string    `json:"symbol"`
+	Exchange  *string   `json:"exchange,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CompanyFollow puts a company's posts, and optionally those of its
+// subsidiaries, in a user's feed.
+type CompanyFollow struct {
+	UserID              int       `json:"-"`
+	CompanyID           int       `json:"company_id"`
+	IncludeSubsidiaries bool      `json:"include_subsidiaries"`
+	CreatedAt           time.Time `json:"created_at"`
+	Company             *Company  `json:"company,omitempty"`
+}
+
+// Ways a CompanyMatch was found.
+const (
+	MatchName   = "name"
+	MatchAlias  = "alias"
+	MatchTicker = "ticker"
+)
+
+// CompanyMatch is a company found by the resolver. Matched is the name, alias
+// or ticker that matched; Score runs from 0 to 1 and is 1 only for exact
+// matches.
+type CompanyMatch struct {
+	Company   *Company `json:"company"`
+	MatchedOn string   `json:"matched_on"`
+	Matched   string   `json:"matched"`
+	Score     float64  `json:"score"`
+}
+
+// Site-wide roles stored in users.role.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Purposes of single-use tokens stored in user_token.
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// Roles granted for a single company, stored in company_role.
+const (
+	CompanyRoleAdmin = "company_admin"
+)
+
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// EmailVerified is set once the user follows the link mailed at signup.
+	EmailVerified bool `json:"email_verified"`
+	MFAEnabled    bool `json:"mfa_enabled"`
+	// CompanyRoles is only loaded when issuing tokens.
+	CompanyRoles []*CompanyRole `json:"company_roles,omitempty"`
 }
 
+// PublicProfile is what other users can see about an account.
+type PublicProfile struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type CompanyRole struct {
+	ID        int       `json:"id,omitempty"`
+	UserID    int       `json:"user_id,omitempty"`
+	CompanyID int       `json:"company_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// Post is a discussion thread about a company. Author is the username, or the
+// author's per-company pseudonym when Anonymous is set, in which case UserID is
+// only returned to the author. VerifiedEmployee reports whether the author has
+// a verified affiliation with the post's company.
 type Post struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description *string   `json:"description,omitempty"`
-	CompanyID   *int      `json:"company_id,omitempty"`
-	UserID      int       `json:"user_id"`
-	Likes       int       `json:"likes"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID               int       `json:"id"`
+	Title            string    `json:"title"`
+	Description      *string   `json:"description,omitempty"`
+	CompanyID        *int      `json:"company_id,omitempty"`
+	UserID           int       `json:"user_id,omitempty"`
+	Author           string    `json:"author"`
+	Anonymous        bool      `json:"anonymous"`
+	Likes            int       `json:"likes"`
+	LikedByMe        bool      `json:"liked_by_me"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	VerifiedEmployee bool      `json:"verified_employee"`
+	// AuthorDeleted is set when the author erased their account; Author is
+	// then a placeholder.
+	AuthorDeleted bool `json:"-"`
 }
 
+// Comment is a reply to a post. Anonymous comments use the author's pseudonym
+// for the parent post's company, and VerifiedEmployee refers to that company.
 type Comment struct {
+	ID               int       `json:"id"`
+	Message          string    `json:"message"`
+	PostID           int       `json:"post_id"`
+	UserID           int       `json:"user_id,omitempty"`
+	Author           string    `json:"author"`
+	Anonymous        bool      `json:"anonymous"`
+	Likes            int       `json:"likes"`
+	LikedByMe        bool      `json:"liked_by_me"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	VerifiedEmployee bool      `json:"verified_employee"`
+	// AuthorDeleted is set when the author erased their account; Author is
+	// then a placeholder.
+	AuthorDeleted bool `json:"-"`
+}
+
+// SearchResult is a post found by full-text search. Snippet holds the best
+// matching fragments of the post's title and description, and Comment the
+// best matching comment when one matched. Snippets are HTML-escaped, with
+// matched words wrapped in <mark> tags.
+type SearchResult struct {
+	Post    *Post           `json:"post"`
+	Rank    float64         `json:"rank"`
+	Snippet string          `json:"snippet"`
+	Comment *CommentSnippet `json:"comment,omitempty"`
+}
+
+// CommentSnippet is the highlighted part of a comment matching a search.
+type CommentSnippet struct {
+	ID      int    `json:"id"`
+	Snippet string `json:"snippet"`
+}
+
+// Employment statuses of a reviewer at the reviewed company.
+const (
+	EmploymentCurrent = "current"
+	EmploymentFormer  = "former"
+)
+
+// Review is a structured company review. Reviews are always shown under the
+// author's pseudonym for the company. Scores run from 1 to 5.
+type Review struct {
+	ID               int       `json:"id"`
+	CompanyID        int       `json:"company_id"`
+	UserID           int       `json:"user_id,omitempty"`
+	Author           string    `json:"author"`
+	Year             int       `json:"year"`
+	Overall          int       `json:"overall"`
+	Compensation     *int      `json:"compensation"`
+	WorkLifeBalance  *int      `json:"work_life_balance"`
+	Management       *int      `json:"management"`
+	Culture          *int      `json:"culture"`
+	CareerGrowth     *int      `json:"career_growth"`
+	Pros             string    `json:"pros"`
+	Cons             string    `json:"cons"`
+	JobTitle         *string   `json:"job_title,omitempty"`
+	EmploymentStatus string    `json:"employment_status"`
+	TenureYears      *int      `json:"tenure_years,omitempty"`
+	VerifiedEmployee bool      `json:"verified_employee"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	AuthorDeleted    bool      `json:"-"`
+}
+
+// Interview outcomes.
+const (
+	InterviewOffer      = "offer"
+	InterviewReject     = "reject"
+	InterviewNoResponse = "no_response"
+)
+
+// Interview is a report of one interview process, shown under the author's
+// pseudonym for the company. Date is formatted YYYY-MM-DD and Difficulty runs
+// from 1 to 5.
+type Interview struct {
+	ID               int       `json:"id"`
+	CompanyID        int       `json:"company_id"`
+	UserID           int       `json:"user_id,omitempty"`
+	Author           string    `json:"author"`
+	Role             string    `json:"role"`
+	Date             string    `json:"date"`
+	Outcome          string    `json:"outcome"`
+	Difficulty       int       `json:"difficulty"`
+	Stages           []string  `json:"stages"`
+	Questions        *string   `json:"questions,omitempty"`
+	VerifiedEmployee bool      `json:"verified_employee"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	AuthorDeleted    bool      `json:"-"`
+}
+
+// InterviewSummary aggregates interview reports. The rate and average are nil
+// when there are no reports.
+type InterviewSummary struct {
+	Count             int      `json:"count"`
+	Offers            int      `json:"offers"`
+	Rejections        int      `json:"rejections"`
+	NoResponse        int      `json:"no_response"`
+	OfferRate         *float64 `json:"offer_rate"`
+	AverageDifficulty *float64 `json:"average_difficulty"`
+}
+
+// Compensation is one user's self-reported yearly pay at a company, in whole
+// units of Currency. Individual submissions are only shown to their author.
+type Compensation struct {
+	ID              int       `json:"id"`
+	CompanyID       int       `json:"company_id"`
+	UserID          int       `json:"user_id"`
+	Year            int       `json:"year"`
+	Title           string    `json:"title"`
+	Level           *string   `json:"level,omitempty"`
+	Location        *string   `json:"location,omitempty"`
+	YearsExperience int       `json:"years_experience"`
+	Currency        string    `json:"currency"`
+	BaseSalary      int       `json:"base_salary"`
+	Bonus           int       `json:"bonus"`
+	Equity          int       `json:"equity"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Percentiles summarises the spread of an amount.
+type Percentiles struct {
+	P25 float64 `json:"p25"`
+	P50 float64 `json:"p50"`
+	P75 float64 `json:"p75"`
+}
+
+// CompensationStats aggregates the submissions sharing the grouped fields;
+// fields that were not grouped on are omitted.
+type CompensationStats struct {
+	CompanyID   *int        `json:"company_id,omitempty"`
+	CompanyName *string     `json:"company_name,omitempty"`
+	Title       *string     `json:"title,omitempty"`
+	Level       *string     `json:"level,omitempty"`
+	Location    *string     `json:"location,omitempty"`
+	Currency    string      `json:"currency"`
+	Count       int         `json:"count"`
+	Base        Percentiles `json:"base_salary"`
+	Bonus       Percentiles `json:"bonus"`
+	Equity      Percentiles `json:"equity"`
+	Total       Percentiles `json:"total"`
+}
+
+// APIKey is a named, scoped credential for scripts and service accounts. Key
+// holds the secret and is only set in the response that creates it.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Identity links an account at an external OpenID provider to a user.
+type Identity struct {
 	ID        int       `json:"id"`
-	Message   string    `json:"message"`
-	PostID    int       `json:"post_id"`
 	UserID    int       `json:"user_id"`
-	Likes     int       `json:"likes"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Like records a user liking a post or comment.
+type Like struct {
+	TargetType string    `json:"target_type"`
+	TargetID   int       `json:"target_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	ErasurePending   = "pending"
+	ErasureRunning   = "running"
+	ErasureCompleted = "completed"
+	ErasureFailed    = "failed"
+)
+
+// ErasureRequest tracks the asynchronous erasure of an account. Its ID is an
+// unguessable token so the status can be checked after the user is signed out.
+// Error holds the database error of a failed run for operators and is never
+// served.
+type ErasureRequest struct {
+	ID          string     `json:"id"`
+	UserID      int        `json:"-"`
+	Status      string     `json:"status"`
+	Error       string     `json:"-"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Session is one sign-in on one device. Current is set when listing the
+// caller's sessions to mark the one making the request.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	SessionID string     `json:"session_id"`
+	UserID    int        `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CompanyDomain is a work email domain claimed by a company. It only counts
+// for affiliations once VerifiedAt is set. DNSRecord tells those managing the
+// company which TXT record proves control of the domain.
+type CompanyDomain struct {
+	ID         int        `json:"id"`
+	CompanyID  int        `json:"company_id"`
+	Domain     string     `json:"domain"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	DNSRecord  *DNSRecord `json:"dns_record,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Token is the value the TXT record must carry.
+	Token string `json:"-"`
+}
+
+// DNSRecord describes a DNS record to publish.
+type DNSRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type AffiliationChallenge struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	CompanyID int       `json:"company_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Affiliation struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	CompanyID  int       `json:"company_id"`
+	Email      string    `json:"email"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+type Pseudonym struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	CompanyID int       `json:"company_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeanonymizationLog struct {
+	ID          int       `json:"id"`
+	ModeratorID *int      `json:"moderator_id,omitempty"`
+	TargetType  string    `json:"target_type"`
+	TargetID    int       `json:"target_id"`
+	UserID      *int      `json:"user_id,omitempty"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
 }
@@ -0,0 +1,134 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/brennanromance/heard/internal/oidc/oidctest"
+)
+
+const testRedirectURL = "http://heard.test/auth/test/callback"
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *Provider) {
+	t.Helper()
+	srv, err := oidctest.NewServer("heard", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	p := NewProvider(Config{
+		Name:         "test",
+		Issuer:       srv.Issuer(),
+		ClientID:     srv.ClientID,
+		ClientSecret: srv.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, srv.Client())
+	return srv, p
+}
+
+// authorize follows authURL to the fake provider and returns the query of
+// its redirect back to Heard.
+func authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query()
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	srv, p := newTestProvider(t)
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != srv.URL+"/authorize" {
+		t.Errorf("endpoint = %s, want %s/authorize", got, srv.URL)
+	}
+	q := u.Query()
+	for k, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "heard",
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        S256Challenge("verifier-1"),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	srv, p := newTestProvider(t)
+	srv.SetUser(oidctest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true, Name: "Ada"})
+	ctx := context.Background()
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authorize(t, authURL)
+	if q.Get("state") != "state-1" {
+		t.Fatalf("state = %q, want state-1", q.Get("state"))
+	}
+	claims, err := p.Exchange(ctx, q.Get("code"), verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err := p.Exchange(ctx, q.Get("code"), verifier, "nonce-1"); err == nil {
+		t.Error("a code was redeemed twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	_, p := newTestProvider(t)
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authorize(t, authURL)
+	if _, err := p.Exchange(ctx, q.Get("code"), "verifier-2", "nonce-1"); err == nil {
+		t.Error("exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	_, p := newTestProvider(t)
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authorize(t, authURL)
+	if _, err := p.Exchange(ctx, q.Get("code"), "verifier-1", "nonce-2"); err == nil {
+		t.Error("exchange accepted an ID token for another nonce")
+	}
+}
@@ -0,0 +1,102 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedList reports whether a password is part of a breach corpus.
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// prefixLen is the length of the SHA-1 prefix used to split the corpus, as in
+// the Pwned Passwords range API.
+const prefixLen = 5
+
+// OpenBreachedList opens a breach corpus in Pwned Passwords format. path is
+// either a directory of range files, one per five hex digit SHA-1 prefix
+// (named "ABCDE" or "ABCDE.txt") holding "SUFFIX:COUNT" lines, or a single file
+// of "SHA1:COUNT" lines that is loaded into memory. Range directories are read
+// one prefix at a time, so the full corpus never has to fit in memory.
+func OpenBreachedList(path string) (BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return rangeDir(path), nil
+	}
+	return loadHashFile(path)
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// hashOf extracts the upper-cased hash from a "HASH[:COUNT]" line.
+func hashOf(line string) string {
+	h, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(h)
+}
+
+type rangeDir string
+
+func (d rangeDir) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+	f, err := os.Open(filepath.Join(string(d), prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(string(d), prefix+".txt"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if hashOf(sc.Text()) == suffix {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+type hashSet map[string]struct{}
+
+func loadHashFile(path string) (hashSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	set := hashSet{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		h := hashOf(sc.Text())
+		if h == "" {
+			continue
+		}
+		if len(h) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: expected a SHA-1 hash", path, line)
+		}
+		set[h] = struct{}{}
+	}
+	return set, sc.Err()
+}
+
+func (s hashSet) Contains(password string) (bool, error) {
+	_, ok := s[sha1Hex(password)]
+	return ok, nil
+}
@@ -0,0 +1,80 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// breached is the password both corpora below contain.
+const breached = "correct horse battery staple"
+
+func TestBreachedHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	// Lower case and a missing count are accepted.
+	writeFile(t, path, strings.ToLower(sha1Hex(breached))+"\n\n"+sha1Hex("hunter2")+":12\n")
+	list, err := OpenBreachedList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBreachedList(t, list)
+}
+
+func TestBreachedHashFileRejectsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	writeFile(t, path, "not-a-hash:1\n")
+	if _, err := OpenBreachedList(path); err == nil {
+		t.Error("OpenBreachedList accepted a line without a SHA-1 hash")
+	}
+}
+
+func TestBreachedRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	h := sha1Hex(breached)
+	writeFile(t, filepath.Join(dir, h[:prefixLen]), "0000000000000000000000000000000000A:3\r\n"+h[prefixLen:]+":42\r\n")
+	h = sha1Hex("hunter2")
+	// Range files may also carry a .txt extension.
+	writeFile(t, filepath.Join(dir, h[:prefixLen]+".txt"), h[prefixLen:]+":12\n")
+	list, err := OpenBreachedList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBreachedList(t, list)
+}
+
+func testBreachedList(t *testing.T, list BreachedList) {
+	t.Helper()
+	for _, tt := range []struct {
+		password string
+		want     bool
+	}{
+		{breached, true},
+		{"hunter2", true},
+		{"copper-Lantern-47-river", false},
+	} {
+		got, err := list.Contains(tt.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+	p := &Policy{MinLength: 10, Breached: list}
+	got, err := p.Check(breached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := codes(got); !reflect.DeepEqual(c, []string{"breached"}) {
+		t.Errorf("Check = %v, want [breached]", c)
+	}
+}
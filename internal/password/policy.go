@@ -0,0 +1,121 @@
+// Package password decides whether a new password is acceptable.
+package password
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest input bcrypt hashes; anything after it is
+// ignored, so longer passwords are rejected rather than silently truncated.
+const bcryptMaxBytes = 72
+
+// Violation describes one way a password fails the policy.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy holds the password rules. The zero value only enforces the bcrypt
+// length limit.
+type Policy struct {
+	MinLength int
+	// MinEntropyBits is the minimum value of Entropy.
+	MinEntropyBits float64
+	// Breached, when set, rejects passwords found in a breach corpus.
+	Breached BreachedList
+}
+
+// DefaultPolicy returns the rules used unless configured otherwise.
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 10, MinEntropyBits: 40}
+}
+
+// Check validates password. personal lists values the password must not
+// contain, such as the username and email address.
+func (p *Policy) Check(password string, personal ...string) ([]Violation, error) {
+	var out []Violation
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		out = append(out, Violation{"too_short", "password must be at least " + strconv.Itoa(p.MinLength) + " characters"})
+	}
+	if len(password) > bcryptMaxBytes {
+		out = append(out, Violation{"too_long", "password must be at most " + strconv.Itoa(bcryptMaxBytes) + " bytes"})
+	}
+	if n > 0 && Entropy(password) < p.MinEntropyBits {
+		out = append(out, Violation{"too_weak", "password is too predictable; use a longer passphrase or more varied characters"})
+	}
+	lower := strings.ToLower(password)
+	for _, v := range personal {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if local, _, ok := strings.Cut(v, "@"); ok {
+			v = local
+		}
+		if len(v) >= 3 && strings.Contains(lower, v) {
+			out = append(out, Violation{"contains_personal_info", "password must not contain your username or email address"})
+			break
+		}
+	}
+	if p.Breached != nil && password != "" {
+		found, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			out = append(out, Violation{"breached", "this password has appeared in a data breach; choose a different one"})
+		}
+	}
+	return out, nil
+}
+
+// Entropy estimates the strength of password in bits from the size of the
+// character classes it draws on. Repeated characters and runs such as "abc"
+// or "321" count for half a character.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	var effective float64
+	var prev rune = -1
+	for _, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+		if prev >= 0 && (r == prev || r == prev+1 || r == prev-1) {
+			effective += 0.5
+		} else {
+			effective++
+		}
+		prev = r
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return effective * math.Log2(float64(pool))
+}
@@ -0,0 +1,66 @@
+package password
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func codes(vs []Violation) []string {
+	out := []string{}
+	for _, v := range vs {
+		out = append(out, v.Code)
+	}
+	return out
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := DefaultPolicy()
+	for _, tt := range []struct {
+		name     string
+		password string
+		personal []string
+		want     []string
+	}{
+		{"strong", "copper-Lantern-47-river", nil, []string{}},
+		{"too short", "Xq7#vP2", nil, []string{"too_short"}},
+		{"too short counts runes", "ñandú-Ärger", nil, []string{}},
+		{"72 bytes", "Tr0ub4dor&3-" + strings.Repeat("x9Q-", 15), nil, []string{}},
+		{"73 bytes", "Tr0ub4dor&3-" + strings.Repeat("x9Q-", 15) + "z", nil, []string{"too_long"}},
+		{"72 bytes of multibyte runes", strings.Repeat("é", 36) + "x", nil, []string{"too_long"}},
+		{"predictable", "aaaaaaaaaaaa", nil, []string{"too_weak"}},
+		{"sequence", "abcdefghijkl", nil, []string{"too_weak"}},
+		{"empty", "", nil, []string{"too_short"}},
+		{"contains username", "xx-AdaLovelace-91!", []string{"adalovelace", "ada@example.com"}, []string{"contains_personal_info"}},
+		{"contains email local part", "my-Grace.Hopper-pw7", []string{"gh", "grace.hopper@example.com"}, []string{"contains_personal_info"}},
+		{"short personal values ignored", "copper-Lantern-47-river", []string{"co", "er@example.com"}, []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Check(tt.password, tt.personal...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := codes(got); !reflect.DeepEqual(c, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, c, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyZeroValue(t *testing.T) {
+	var p Policy
+	got, err := p.Check("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("zero policy rejected a short password: %v", codes(got))
+	}
+	got, err = p.Check(strings.Repeat("a", bcryptMaxBytes+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := codes(got); !reflect.DeepEqual(c, []string{"too_long"}) {
+		t.Errorf("zero policy = %v, want [too_long]", c)
+	}
+}
@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// maxChallengeAttempts bounds how many codes may be guessed per challenge.
+const maxChallengeAttempts = 5
+
+var (
+	ErrChallengeNotFound = errors.New("verification challenge not found")
+	ErrChallengeExpired  = errors.New("verification challenge expired")
+	ErrChallengeCode     = errors.New("incorrect verification code")
+)
+
+type AffiliationRepo struct{ db *sql.DB }
+
+func NewAffiliationRepo(db *sql.DB) *AffiliationRepo { return &AffiliationRepo{db: db} }
+
+// AddDomain records a company's claim on a domain. The claim is verified
+// straight away when d.VerifiedAt is set.
+func (r *AffiliationRepo) AddDomain(ctx context.Context, d *models.CompanyDomain) error {
+	d.Verified = d.VerifiedAt != nil
+	return r.db.QueryRowContext(ctx, `INSERT INTO company_domain (company_id, domain, verification_token, verified_at) VALUES ($1,$2,$3,$4) RETURNING id, created_at`, d.CompanyID, d.Domain, d.Token, d.VerifiedAt).Scan(&d.ID, &d.CreatedAt)
+}
+
+func (r *AffiliationRepo) DeleteDomain(ctx context.Context, companyID int, domain string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM company_domain WHERE company_id=$1 AND domain=$2`, companyID, domain)
+	return err
+}
+
+const domainColumns = `id, company_id, domain, verification_token, verified_at, created_at`
+
+func scanDomain(row rowScanner) (*models.CompanyDomain, error) {
+	var d models.CompanyDomain
+	if err := row.Scan(&d.ID, &d.CompanyID, &d.Domain, &d.Token, &d.VerifiedAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.Verified = d.VerifiedAt != nil
+	return &d, nil
+}
+
+func (r *AffiliationRepo) ListDomains(ctx context.Context, companyID int) ([]*models.CompanyDomain, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+domainColumns+` FROM company_domain WHERE company_id=$1 ORDER BY domain`, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.CompanyDomain
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// GetDomain returns a company's claim on domain.
+func (r *AffiliationRepo) GetDomain(ctx context.Context, companyID int, domain string) (*models.CompanyDomain, error) {
+	return scanDomain(r.db.QueryRowContext(ctx, `SELECT `+domainColumns+` FROM company_domain WHERE company_id=$1 AND domain=$2`, companyID, domain))
+}
+
+// MarkDomainVerified records that the company proved control of the domain.
+// It fails with a unique violation when another company already has.
+func (r *AffiliationRepo) MarkDomainVerified(ctx context.Context, d *models.CompanyDomain) error {
+	err := r.db.QueryRowContext(ctx, `UPDATE company_domain SET verified_at=COALESCE(verified_at, now()) WHERE id=$1 RETURNING verified_at`, d.ID).Scan(&d.VerifiedAt)
+	if err != nil {
+		return err
+	}
+	d.Verified = true
+	return nil
+}
+
+// FindDomain returns the most specific verified domain among candidates.
+func (r *AffiliationRepo) FindDomain(ctx context.Context, candidates []string) (*models.CompanyDomain, error) {
+	return scanDomain(r.db.QueryRowContext(ctx, `SELECT `+domainColumns+` FROM company_domain WHERE domain = ANY($1) AND verified_at IS NOT NULL ORDER BY length(domain) DESC LIMIT 1`, candidates))
+}
+
+func (r *AffiliationRepo) CreateChallenge(ctx context.Context, c *models.AffiliationChallenge, codeHash string) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO affiliation_challenge (user_id, company_id, email, code_hash, expires_at) VALUES ($1,$2,$3,$4,$5) RETURNING id`, c.UserID, c.CompanyID, c.Email, codeHash, c.ExpiresAt).Scan(&c.ID)
+}
+
+// ConfirmChallenge checks codeHash against the user's pending challenge and,
+// when it matches, records the verified affiliation.
+func (r *AffiliationRepo) ConfirmChallenge(ctx context.Context, userID, challengeID int, codeHash string) (*models.Affiliation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c models.AffiliationChallenge
+	var storedHash string
+	var attempts int
+	err = tx.QueryRowContext(ctx, `SELECT id, user_id, company_id, email, code_hash, attempts, expires_at FROM affiliation_challenge
+		WHERE id=$1 AND user_id=$2 AND consumed_at IS NULL FOR UPDATE`, challengeID, userID).Scan(&c.ID, &c.UserID, &c.CompanyID, &c.Email, &storedHash, &attempts, &c.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(c.ExpiresAt) || attempts >= maxChallengeAttempts {
+		return nil, ErrChallengeExpired
+	}
+	if storedHash != codeHash {
+		if _, err := tx.ExecContext(ctx, `UPDATE affiliation_challenge SET attempts = attempts + 1 WHERE id=$1`, c.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrChallengeCode
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE affiliation_challenge SET consumed_at=now() WHERE id=$1`, c.ID); err != nil {
+		return nil, err
+	}
+	a := models.Affiliation{UserID: c.UserID, CompanyID: c.CompanyID, Email: c.Email}
+	err = tx.QueryRowContext(ctx, `INSERT INTO user_company_affiliation (user_id, company_id, email) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id, company_id) DO UPDATE SET email=EXCLUDED.email, verified_at=now()
+		RETURNING id, verified_at`, a.UserID, a.CompanyID, a.Email).Scan(&a.ID, &a.VerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, tx.Commit()
+}
+
+var affiliationsOldest = keyset{name: "old", exprs: []string{`verified_at`, `id`}, kinds: []keyKind{keyTime, keyInt}}
+
+// PageForUser returns one page of a user's affiliations, oldest first.
+func (r *AffiliationRepo) PageForUser(ctx context.Context, userID int, p Page) ([]*models.Affiliation, string, error) {
+	q := pageQuery{columns: `id, user_id, company_id, email, verified_at`, from: `FROM user_company_affiliation`}
+	q.where = append(q.where, `user_id = `+q.arg(userID))
+	return listPage(ctx, r.db, q, affiliationsOldest, p, func(row rowScanner) (*models.Affiliation, error) {
+		var a models.Affiliation
+		if err := row.Scan(&a.ID, &a.UserID, &a.CompanyID, &a.Email, &a.VerifiedAt); err != nil {
+			return nil, err
+		}
+		return &a, nil
+	})
+}
+
+func (r *AffiliationRepo) ListForUser(ctx context.Context, userID int) ([]*models.Affiliation, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, user_id, company_id, email, verified_at FROM user_company_affiliation WHERE user_id=$1 ORDER BY verified_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Affiliation
+	for rows.Next() {
+		var a models.Affiliation
+		if err := rows.Scan(&a.ID, &a.UserID, &a.CompanyID, &a.Email, &a.VerifiedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &a)
+	}
+	return out, rows.Err()
+}
+
+func (r *AffiliationRepo) Delete(ctx context.Context, userID, companyID int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_company_affiliation WHERE user_id=$1 AND company_id=$2`, userID, companyID)
+	return err
+}
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// lastUsedGranularity bounds how often last_used_at is written for a busy key.
+const lastUsedGranularity = time.Minute
+
+type APIKeyRepo struct{ db *sql.DB }
+
+func NewAPIKeyRepo(db *sql.DB) *APIKeyRepo { return &APIKeyRepo{db: db} }
+
+const (
+	apiKeyColumns = `id, user_id, name, key_prefix, scopes, created_at, expires_at, last_used_at, revoked_at`
+	apiKeySelect  = `SELECT ` + apiKeyColumns + ` FROM api_key`
+)
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	return &k, nil
+}
+
+func (r *APIKeyRepo) Create(ctx context.Context, k *models.APIKey, keyHash string) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO api_key (user_id, name, key_prefix, key_hash, scopes, expires_at) VALUES ($1,$2,$3,$4,$5,$6) RETURNING id, created_at`, k.UserID, k.Name, k.Prefix, keyHash, strings.Join(k.Scopes, " "), k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+}
+
+// Authenticate returns the active key with the given hash and records that it
+// was used. Keys of accounts awaiting erasure never authenticate.
+func (r *APIKeyRepo) Authenticate(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, apiKeySelect+` WHERE key_hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)`, keyHash))
+	if err != nil {
+		return nil, err
+	}
+	if k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > lastUsedGranularity {
+		if _, err := r.db.ExecContext(ctx, `UPDATE api_key SET last_used_at=now() WHERE id=$1`, k.ID); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+var apiKeysByID = keyset{name: "id", exprs: []string{`id`}, kinds: []keyKind{keyInt}}
+
+// PageForUser returns one page of a user's keys, oldest first.
+func (r *APIKeyRepo) PageForUser(ctx context.Context, userID int, p Page) ([]*models.APIKey, string, error) {
+	q := pageQuery{columns: apiKeyColumns, from: `FROM api_key`}
+	q.where = append(q.where, `user_id = `+q.arg(userID))
+	return listPage(ctx, r.db, q, apiKeysByID, p, scanAPIKey)
+}
+
+func (r *APIKeyRepo) ListForUser(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, apiKeySelect+` WHERE user_id=$1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// Revoke disables a key. It returns sql.ErrNoRows when userID has no such
+// active key.
+func (r *APIKeyRepo) Revoke(ctx context.Context, userID, id int) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE api_key SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
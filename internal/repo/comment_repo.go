@@ -11,81 +11,79 @@ type CommentRepo struct{ db *sql.DB }
 
 func NewCommentRepo(db *sql.DB) *CommentRepo { return &CommentRepo{db: db} }
 
-func (r *CommentRepo) Create(ctx context.Context, c *models.Comment) error {
-	var id int
+// commentSelect lists comment columns, the author's display name (their
+// pseudonym for the parent post's company when the comment is anonymous) and
+// whether the author is a verified employee of that company.
+const (
+	commentColumns = `c.id, c.message, c.post_id, c.user_id,
+	CASE WHEN u.deleted_at IS NOT NULL THEN '[deleted user]' WHEN c.anonymous THEN COALESCE(ps.name, 'Anonymous') ELSE u.username END,
+	c.anonymous, c.likes, c.created_at, c.updated_at,
+	EXISTS(SELECT 1 FROM user_company_affiliation a WHERE a.user_id = c.user_id AND a.company_id = p.company_id),
+	u.deleted_at IS NOT NULL`
+	commentFrom = `FROM comment c
+	JOIN post p ON p.id = c.post_id
+	JOIN users u ON u.id = c.user_id
+	LEFT JOIN pseudonym ps ON ps.user_id = c.user_id AND ps.company_id = p.company_id`
+	commentSelect = `SELECT ` + commentColumns + ` ` + commentFrom
+)
+
+func scanComment(row rowScanner) (*models.Comment, error) {
+	var c models.Comment
 	var createdAt, updatedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, `INSERT INTO comment (message, post_id, user_id, likes) VALUES ($1,$2,$3,$4) RETURNING id, created_at, updated_at`, c.Message, c.PostID, c.UserID, c.Likes).Scan(&id, &createdAt, &updatedAt)
-	if err != nil {
-		return err
+	if err := row.Scan(&c.ID, &c.Message, &c.PostID, &c.UserID, &c.Author, &c.Anonymous, &c.Likes, &createdAt, &updatedAt, &c.VerifiedEmployee, &c.AuthorDeleted); err != nil {
+		return nil, err
 	}
-	c.ID = id
 	if createdAt.Valid {
 		c.CreatedAt = createdAt.Time
 	}
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	}
-	return nil
+	return &c, nil
 }
 
-func (r *CommentRepo) ToggleLike(ctx context.Context, userID, commentID int) (bool, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return false, err
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
+func (r *CommentRepo) Create(ctx context.Context, c *models.Comment) error {
 	var id int
-	err = tx.QueryRowContext(ctx, `SELECT id FROM comment_likes WHERE user_id=$1 AND comment_id=$2`, userID, commentID).Scan(&id)
-	if err == sql.ErrNoRows {
-		// insert
-		if err = tx.QueryRowContext(ctx, `INSERT INTO comment_likes (user_id, comment_id) VALUES ($1,$2) RETURNING id`, userID, commentID).Scan(&id); err != nil {
-			tx.Rollback()
-			return false, err
-		}
-		if err = tx.Commit(); err != nil {
-			return false, err
-		}
-		return true, nil
-	}
-	if err != nil {
-		tx.Rollback()
-		return false, err
-	}
-	// exists -> delete
-	if _, err = tx.ExecContext(ctx, `DELETE FROM comment_likes WHERE id=$1`, id); err != nil {
-		tx.Rollback()
-		return false, err
-	}
-	if err = tx.Commit(); err != nil {
-		return false, err
-	}
-	return false, nil
-}
-
-func (r *CommentRepo) GetByID(ctx context.Context, id int) (*models.Comment, error) {
-	var c models.Comment
 	var createdAt, updatedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, `SELECT id, message, post_id, user_id, likes, created_at, updated_at FROM comment WHERE id=$1`, id).Scan(&c.ID, &c.Message, &c.PostID, &c.UserID, &c.Likes, &createdAt, &updatedAt)
+	err := r.db.QueryRowContext(ctx, `INSERT INTO comment (message, post_id, user_id, anonymous) VALUES ($1,$2,$3,$4) RETURNING id, created_at, updated_at`, c.Message, c.PostID, c.UserID, c.Anonymous).Scan(&id, &createdAt, &updatedAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	c.ID = id
 	if createdAt.Valid {
 		c.CreatedAt = createdAt.Time
 	}
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	}
-	return &c, nil
+	return nil
+}
+
+// ToggleLike likes a comment for userID, or takes the like back when there
+// already is one, and returns the new state with the comment's like count.
+// Returns sql.ErrNoRows when the comment does not exist.
+func (r *CommentRepo) ToggleLike(ctx context.Context, userID, commentID int) (bool, int, error) {
+	return toggleLike(ctx, r.db, "comment", "comment_likes", "comment_id", userID, commentID)
+}
+
+// LikedBy reports which of the comments in ids userID has liked.
+func (r *CommentRepo) LikedBy(ctx context.Context, userID int, ids []int) (map[int]bool, error) {
+	return likedBy(ctx, r.db, `SELECT comment_id FROM comment_likes WHERE user_id=$1 AND comment_id = ANY($2)`, userID, ids)
+}
+
+// ReconcileLikes recomputes every comment's like count from comment_likes
+// and returns how many counts were wrong.
+func (r *CommentRepo) ReconcileLikes(ctx context.Context) (int64, error) {
+	return reconcileLikes(ctx, r.db, "comment", "comment_likes", "comment_id")
+}
+
+func (r *CommentRepo) GetByID(ctx context.Context, id int) (*models.Comment, error) {
+	return scanComment(r.db.QueryRowContext(ctx, commentSelect+` WHERE c.id=$1`, id))
 }
 
 func (r *CommentRepo) Update(ctx context.Context, c *models.Comment) error {
 	var updatedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, `UPDATE comment SET message=$1, post_id=$2, user_id=$3, likes=$4 WHERE id=$5 RETURNING updated_at`, c.Message, c.PostID, c.UserID, c.Likes, c.ID).Scan(&updatedAt)
+	err := r.db.QueryRowContext(ctx, `UPDATE comment SET message=$1, post_id=$2, user_id=$3, anonymous=$4 WHERE id=$5 RETURNING updated_at, likes`, c.Message, c.PostID, c.UserID, c.Anonymous, c.ID).Scan(&updatedAt, &c.Likes)
 	if err != nil {
 		return err
 	}
@@ -100,26 +98,33 @@ func (r *CommentRepo) Delete(ctx context.Context, id int) error {
 	return err
 }
 
-func (r *CommentRepo) List(ctx context.Context) ([]*models.Comment, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, message, post_id, user_id, likes, created_at, updated_at FROM comment ORDER BY id`)
+// commentsOldest orders comments oldest first, the way threads are read.
+var commentsOldest = keyset{name: "old", exprs: []string{`c.created_at`, `c.id`}, kinds: []keyKind{keyTime, keyInt}}
+
+// List returns one page of comments, oldest first.
+func (r *CommentRepo) List(ctx context.Context, p Page) ([]*models.Comment, string, error) {
+	return listPage(ctx, r.db, pageQuery{columns: commentColumns, from: commentFrom}, commentsOldest, p, scanComment)
+}
+
+// ListByUser returns every comment written by a user, anonymous or not.
+func (r *CommentRepo) ListByUser(ctx context.Context, userID int) ([]*models.Comment, error) {
+	rows, err := r.db.QueryContext(ctx, commentSelect+` WHERE c.user_id=$1 ORDER BY c.id`, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var out []*models.Comment
 	for rows.Next() {
-		var c models.Comment
-		var createdAt, updatedAt sql.NullTime
-		if err := rows.Scan(&c.ID, &c.Message, &c.PostID, &c.UserID, &c.Likes, &createdAt, &updatedAt); err != nil {
+		c, err := scanComment(rows)
+		if err != nil {
 			return nil, err
 		}
-		if createdAt.Valid {
-			c.CreatedAt = createdAt.Time
-		}
-		if updatedAt.Valid {
-			c.UpdatedAt = updatedAt.Time
-		}
-		out = append(out, &c)
+		out = append(out, c)
 	}
-	return out, nil
+	return out, rows.Err()
+}
+
+// LikesByUser returns the comments a user liked.
+func (r *CommentRepo) LikesByUser(ctx context.Context, userID int) ([]*models.Like, error) {
+	return listLikes(ctx, r.db, `SELECT 'comment', comment_id, created_at FROM comment_likes WHERE user_id=$1 ORDER BY created_at`, userID)
 }
@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+var (
+	// ErrAliasTaken is returned when another alias already reads the same,
+	// ignoring case and accents.
+	ErrAliasTaken = errors.New("alias is already in use")
+	// ErrTickerTaken is returned when the symbol belongs to a company already.
+	ErrTickerTaken = errors.New("ticker is already in use")
+)
+
+func (r *CompanyRepo) AddAlias(ctx context.Context, a *models.CompanyAlias) error {
+	err := r.db.QueryRowContext(ctx, `INSERT INTO company_alias (company_id, alias) VALUES ($1,$2) RETURNING id, created_at`,
+		a.CompanyID, a.Alias).Scan(&a.ID, &a.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrAliasTaken
+	}
+	return err
+}
+
+func (r *CompanyRepo) ListAliases(ctx context.Context, companyID int) ([]*models.CompanyAlias, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, company_id, alias, created_at FROM company_alias WHERE company_id=$1 ORDER BY lower(alias), id`, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*models.CompanyAlias{}
+	for rows.Next() {
+		var a models.CompanyAlias
+		if err := rows.Scan(&a.ID, &a.CompanyID, &a.Alias, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &a)
+	}
+	return out, rows.Err()
+}
+
+// DeleteAlias removes one of a company's aliases, returning sql.ErrNoRows when
+// the company has no alias with that id.
+func (r *CompanyRepo) DeleteAlias(ctx context.Context, companyID, id int) error {
+	return deleteOne(ctx, r.db, `DELETE FROM company_alias WHERE id=$1 AND company_id=$2`, id, companyID)
+}
+
+func (r *CompanyRepo) AddTicker(ctx context.Context, t *models.CompanyTicker) error {
+	err := r.db.QueryRowContext(ctx, `INSERT INTO company_ticker (company_id, symbol, exchange) VALUES ($1,$2,$3) RETURNING id, created_at`,
+		t.CompanyID, t.Symbol, t.Exchange).Scan(&t.ID, &t.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrTickerTaken
+	}
+	return err
+}
+
+func (r *CompanyRepo) ListTickers(ctx context.Context, companyID int) ([]*models.CompanyTicker, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, company_id, symbol, exchange, created_at FROM company_ticker WHERE company_id=$1 ORDER BY symbol`, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*models.CompanyTicker{}
+	for rows.Next() {
+		var t models.CompanyTicker
+		if err := rows.Scan(&t.ID, &t.CompanyID, &t.Symbol, &t.Exchange, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &t)
+	}
+	return out, rows.Err()
+}
+
+// DeleteTicker removes one of a company's tickers, returning sql.ErrNoRows
+// when the company has no ticker with that id.
+func (r *CompanyRepo) DeleteTicker(ctx context.Context, companyID, id int) error {
+	return deleteOne(ctx, r.db, `DELETE FROM company_ticker WHERE id=$1 AND company_id=$2`, id, companyID)
+}
+
+func deleteOne(ctx context.Context, db *sql.DB, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// resolveQuery scores every name and alias that is trigram-similar to $1,
+// ignoring case and accents, plus the ticker equal to it. Exact matches score
+// 1 and fuzzy ones stay below, so an exact hit always ranks first. Each
+// company is listed once, under its best match.
+const resolveQuery = `WITH q AS (SELECT lower(immutable_unaccent(trim($1))) AS q),
+	candidates AS (
+		SELECT c.id AS company_id, 'name' AS matched_on, c.name AS matched, lower(immutable_unaccent(c.name)) AS norm
+		FROM company c, q WHERE lower(immutable_unaccent(c.name)) % q.q OR q.q <% lower(immutable_unaccent(c.name))
+		UNION ALL
+		SELECT a.company_id, 'alias', a.alias, lower(immutable_unaccent(a.alias))
+		FROM company_alias a, q WHERE lower(immutable_unaccent(a.alias)) % q.q OR q.q <% lower(immutable_unaccent(a.alias))
+	),
+	scored AS (
+		SELECT company_id, matched_on, matched,
+			CASE WHEN norm = q.q THEN 1 ELSE least(greatest(similarity(norm, q.q), word_similarity(q.q, norm)), 0.99) END AS score
+		FROM candidates, q
+		UNION ALL
+		SELECT t.company_id, 'ticker', t.symbol, 1 FROM company_ticker t WHERE t.symbol = upper(trim($1))
+	),
+	best AS (
+		SELECT DISTINCT ON (company_id) company_id, matched_on, matched, score::float8 AS score
+		FROM scored WHERE score >= $2 ORDER BY company_id, score DESC, matched_on
+	)
+	SELECT ` + companyColumns + `, best.matched_on, best.matched, best.score ` + companyFrom + `
+	JOIN best ON best.company_id = c.id
+	ORDER BY best.score DESC, lower(immutable_unaccent(c.name)), c.id LIMIT $3`
+
+// Resolve finds up to limit companies named, aliased or traded as q, best
+// match first. Matches scoring below minScore are dropped; pass 1 for exact
+// matches only.
+func (r *CompanyRepo) Resolve(ctx context.Context, q string, minScore float64, limit int) ([]*models.CompanyMatch, error) {
+	return resolve(ctx, r.db, q, minScore, limit)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func resolve(ctx context.Context, db queryer, q string, minScore float64, limit int) ([]*models.CompanyMatch, error) {
+	rows, err := db.QueryContext(ctx, resolveQuery, q, minScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*models.CompanyMatch{}
+	for rows.Next() {
+		var m models.CompanyMatch
+		c, err := scanCompany(matchScanner{rows, &m})
+		if err != nil {
+			return nil, err
+		}
+		m.Company = c
+		out = append(out, &m)
+	}
+	return out, rows.Err()
+}
+
+// matchScanner appends the match columns of resolveQuery to a company scan.
+type matchScanner struct {
+	row rowScanner
+	m   *models.CompanyMatch
+}
+
+func (s matchScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, &s.m.MatchedOn, &s.m.Matched, &s.m.Score)...)
+}
@@ -3,7 +3,11 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/brennanromance/heard/internal/catalog"
 	"github.com/brennanromance/heard/internal/models"
 )
 
@@ -23,14 +27,23 @@ func (r *CompanyRepo) Create(ctx context.Context, c *models.Company) error {
 	return nil
 }
 
-func (r *CompanyRepo) GetByID(ctx context.Context, id int) (*models.Company, error) {
+// companySelect lists company columns followed by the aggregate of its
+// reviews.
+const (
+	companyColumns = `c.id, c.name, c.description, c.parent_company_id, c.industry, c.sub_industry, c.headquarters, c.date_incorporated, c.user_id, ` + ratingColumns
+	companyFrom    = `FROM company c CROSS JOIN LATERAL (SELECT ` + ratingAggregates + ` FROM company_review r WHERE r.company_id = c.id) rs`
+	companySelect  = `SELECT ` + companyColumns + ` ` + companyFrom
+)
+
+func scanCompany(row rowScanner) (*models.Company, error) {
 	var c models.Company
 	var sub sql.NullString
 	var hq sql.NullString
 	var dt sql.NullTime
 	var uid sql.NullInt32
-	err := r.db.QueryRowContext(ctx, `SELECT id, name, description, parent_company_id, industry, sub_industry, headquarters, date_incorporated, user_id FROM company WHERE id=$1`, id).Scan(&c.ID, &c.Name, &c.Description, &c.ParentCompanyID, &c.Industry, &sub, &hq, &dt, &uid)
-	if err != nil {
+	rs := &c.Ratings
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.ParentCompanyID, &c.Industry, &sub, &hq, &dt, &uid,
+		&rs.Count, &rs.Overall, &rs.Compensation, &rs.WorkLifeBalance, &rs.Management, &rs.Culture, &rs.CareerGrowth); err != nil {
 		return nil, err
 	}
 	if sub.Valid {
@@ -52,6 +65,10 @@ func (r *CompanyRepo) GetByID(ctx context.Context, id int) (*models.Company, err
 	return &c, nil
 }
 
+func (r *CompanyRepo) GetByID(ctx context.Context, id int) (*models.Company, error) {
+	return scanCompany(r.db.QueryRowContext(ctx, companySelect+` WHERE c.id=$1`, id))
+}
+
 func (r *CompanyRepo) Update(ctx context.Context, c *models.Company) error {
 	_, err := r.db.ExecContext(ctx, `UPDATE company SET name=$1, description=$2, parent_company_id=$3, industry=$4, sub_industry=$5, headquarters=$6, date_incorporated=$7, user_id=$8 WHERE id=$9`, c.Name, c.Description, c.ParentCompanyID, c.Industry, c.SubIndustry, c.Headquarters, c.DateIncorporated, c.UserID, c.ID)
 	return err
@@ -62,39 +79,298 @@ func (r *CompanyRepo) Delete(ctx context.Context, id int) error {
 	return err
 }
 
-func (r *CompanyRepo) List(ctx context.Context) ([]*models.Company, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, name, description, parent_company_id, industry, sub_industry, headquarters, date_incorporated, user_id FROM company ORDER BY id`)
+// Company sort orders accepted by CompanyFilter.Sort. A leading "-" reverses
+// the order.
+const (
+	CompanySortName         = "name"
+	CompanySortIncorporated = "incorporated"
+	CompanySortActivity     = "activity"
+)
+
+// CompanyFilter narrows and orders List. Empty fields are ignored; text
+// comparisons ignore case and accents.
+type CompanyFilter struct {
+	// Query matches anywhere in the name or an alias, or a ticker exactly;
+	// Prefix matches only at the start of the name.
+	Query       string
+	Prefix      string
+	Industry    string
+	SubIndustry string
+	// HQCity and HQState match the parts of "City, State" headquarters.
+	HQCity             string
+	HQState            string
+	IncorporatedAfter  *time.Time
+	IncorporatedBefore *time.Time
+	Sort               string
+}
+
+// companyOrders maps sort keys to their keysets. Activity counts posts about
+// the company; companies without an incorporation date sort last either way.
+var companyOrders = map[string]keyset{
+	"":                            {name: "id", exprs: []string{`c.id`}, kinds: []keyKind{keyInt}},
+	CompanySortName:               {name: "name", exprs: []string{`lower(immutable_unaccent(c.name))`, `c.id`}, kinds: []keyKind{keyString, keyInt}},
+	"-" + CompanySortName:         {name: "-name", exprs: []string{`lower(immutable_unaccent(c.name))`, `c.id`}, kinds: []keyKind{keyString, keyInt}, desc: true},
+	CompanySortIncorporated:       {name: "incorporated", exprs: []string{`COALESCE(c.date_incorporated, DATE '9999-12-31')`, `c.id`}, kinds: []keyKind{keyTime, keyInt}},
+	"-" + CompanySortIncorporated: {name: "-incorporated", exprs: []string{`COALESCE(c.date_incorporated, DATE '0001-01-01')`, `c.id`}, kinds: []keyKind{keyTime, keyInt}, desc: true},
+	CompanySortActivity:           {name: "activity", exprs: []string{`(SELECT count(*) FROM post p WHERE p.company_id = c.id)`, `c.id`}, kinds: []keyKind{keyInt, keyInt}, desc: true},
+	"-" + CompanySortActivity:     {name: "-activity", exprs: []string{`(SELECT count(*) FROM post p WHERE p.company_id = c.id)`, `c.id`}, kinds: []keyKind{keyInt, keyInt}},
+}
+
+// ValidCompanySort reports whether sort is accepted by List.
+func ValidCompanySort(sort string) bool {
+	_, ok := companyOrders[sort]
+	return ok
+}
+
+// List returns one page of the companies matching f. Every value is passed as
+// a query argument; only the fixed clauses above are spliced into the SQL.
+func (r *CompanyRepo) List(ctx context.Context, f CompanyFilter, p Page) ([]*models.Company, string, error) {
+	q := pageQuery{columns: companyColumns, from: companyFrom}
+	arg := q.arg
+	if f.Query != "" {
+		like := `'%' || lower(immutable_unaccent(` + arg(escapeLike(f.Query)) + `)) || '%'`
+		q.where = append(q.where, `(lower(immutable_unaccent(c.name)) LIKE `+like+`
+			OR EXISTS (SELECT 1 FROM company_alias a WHERE a.company_id = c.id AND lower(immutable_unaccent(a.alias)) LIKE `+like+`)
+			OR EXISTS (SELECT 1 FROM company_ticker t WHERE t.company_id = c.id AND t.symbol = upper(`+arg(f.Query)+`)))`)
+	}
+	if f.Prefix != "" {
+		q.where = append(q.where, `lower(immutable_unaccent(c.name)) LIKE lower(immutable_unaccent(`+arg(escapeLike(f.Prefix))+`)) || '%'`)
+	}
+	if f.Industry != "" {
+		q.where = append(q.where, `lower(c.industry) = lower(`+arg(f.Industry)+`)`)
+	}
+	if f.SubIndustry != "" {
+		q.where = append(q.where, `lower(c.sub_industry) = lower(`+arg(f.SubIndustry)+`)`)
+	}
+	if f.HQCity != "" {
+		q.where = append(q.where, `lower(immutable_unaccent(trim(split_part(c.headquarters, ',', 1)))) = lower(immutable_unaccent(`+arg(f.HQCity)+`))`)
+	}
+	if f.HQState != "" {
+		q.where = append(q.where, `lower(immutable_unaccent(trim(regexp_replace(c.headquarters, '^.*,', '')))) = lower(immutable_unaccent(`+arg(f.HQState)+`))`)
+	}
+	if f.IncorporatedAfter != nil {
+		q.where = append(q.where, `c.date_incorporated >= `+arg(*f.IncorporatedAfter))
+	}
+	if f.IncorporatedBefore != nil {
+		q.where = append(q.where, `c.date_incorporated <= `+arg(*f.IncorporatedBefore))
+	}
+	return listPage(ctx, r.db, q, companyOrders[f.Sort], p, scanCompany)
+}
+
+// escapeLike quotes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ListByOwner returns the companies a user created.
+func (r *CompanyRepo) ListByOwner(ctx context.Context, userID int) ([]*models.Company, error) {
+	return r.list(ctx, companySelect+` WHERE c.user_id=$1 ORDER BY c.id`, userID)
+}
+
+func (r *CompanyRepo) list(ctx context.Context, query string, args ...interface{}) ([]*models.Company, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var out []*models.Company
 	for rows.Next() {
-		var c models.Company
-		var sub sql.NullString
-		var hq sql.NullString
-		var dt sql.NullTime
-		var uid sql.NullInt32
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.ParentCompanyID, &c.Industry, &sub, &hq, &dt, &uid); err != nil {
+		c, err := scanCompany(rows)
+		if err != nil {
 			return nil, err
 		}
-		if sub.Valid {
-			s := sub.String
-			c.SubIndustry = &s
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// companySubtree returns a subquery selecting the id bound to param and every
+// company below it. UNION discards rows already seen, so a cycle that slipped
+// into the data ends the recursion instead of looping.
+func companySubtree(param string) string {
+	return `(WITH RECURSIVE subtree(id) AS (
+		SELECT ` + param + `::int
+		UNION
+		SELECT c.id FROM company c JOIN subtree s ON c.parent_company_id = s.id
+	) SELECT id FROM subtree)`
+}
+
+// Subsidiaries returns the tree of companies below id, ordered by name at
+// every level.
+func (r *CompanyRepo) Subsidiaries(ctx context.Context, id int) ([]*models.CompanyNode, error) {
+	list, err := r.list(ctx, companySelect+` WHERE c.id IN `+companySubtree(`$1`)+` AND c.id <> $1 ORDER BY lower(immutable_unaccent(c.name)), c.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[int]*models.CompanyNode, len(list))
+	for _, c := range list {
+		nodes[c.ID] = &models.CompanyNode{Company: *c, Subsidiaries: []*models.CompanyNode{}}
+	}
+	roots := []*models.CompanyNode{}
+	for _, c := range list {
+		n := nodes[c.ID]
+		if *c.ParentCompanyID == id {
+			roots = append(roots, n)
+		} else if parent, ok := nodes[*c.ParentCompanyID]; ok {
+			parent.Subsidiaries = append(parent.Subsidiaries, n)
 		}
-		if hq.Valid {
-			h := hq.String
-			c.Headquarters = &h
+	}
+	return roots, nil
+}
+
+// Ancestors returns the companies above id, starting with its direct parent
+// and ending with the top of the hierarchy.
+func (r *CompanyRepo) Ancestors(ctx context.Context, id int) ([]*models.Company, error) {
+	return r.list(ctx, `WITH RECURSIVE up(id, depth, path) AS (
+			SELECT c.parent_company_id, 1, ARRAY[c.id] FROM company c WHERE c.id=$1 AND c.parent_company_id IS NOT NULL
+			UNION ALL
+			SELECT c.parent_company_id, up.depth + 1, up.path || c.id
+			FROM company c JOIN up ON c.id = up.id
+			WHERE c.parent_company_id IS NOT NULL AND NOT c.parent_company_id = ANY(up.path || c.id)
+		)
+		`+companySelect+` JOIN up ON up.id = c.id ORDER BY up.depth`, id)
+}
+
+// WouldCycle reports whether making parentID the parent of id would put id
+// below itself in the hierarchy.
+func (r *CompanyRepo) WouldCycle(ctx context.Context, id, parentID int) (bool, error) {
+	var cycle bool
+	err := r.db.QueryRowContext(ctx, `SELECT $2::int IN `+companySubtree(`$1`), id, parentID).Scan(&cycle)
+	return cycle, err
+}
+
+// ImportResult summarises an import. Nothing is written when Errors is not
+// empty.
+type ImportResult struct {
+	DryRun  bool               `json:"dry_run"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Errors  []catalog.RowError `json:"errors"`
+}
+
+// Import upserts recs by name in one transaction, then points each at the
+// parent it names, which may be another record or an existing company. Only
+// the columns a record supplies are written, so existing companies keep the
+// fields and parent the input leaves out; a supplied empty value clears one.
+// New companies are owned by userID. The transaction is rolled back when
+// dryRun is set or any record fails.
+func (r *CompanyRepo) Import(ctx context.Context, recs []*catalog.Record, userID int, dryRun bool) (*ImportResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &ImportResult{DryRun: dryRun, Errors: []catalog.RowError{}}
+	ids := make([]int, len(recs))
+	for i, rec := range recs {
+		// Like a rename, a record may not take another company's name,
+		// alias or ticker; it can only update the company it names exactly.
+		matches, err := resolve(ctx, tx, rec.Name, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		if conflict := otherCompany(matches, rec.Name); conflict != nil {
+			res.Errors = append(res.Errors, catalog.RowError{Line: rec.Line, Field: "name", Code: "conflict",
+				Message: strconv.Quote(rec.Name) + " is the " + conflict.MatchedOn + " of " + strconv.Quote(conflict.Company.Name)})
+			continue
+		}
+		// Setting name to itself keeps RETURNING working when nothing else is
+		// supplied.
+		sets := []string{`name=EXCLUDED.name`}
+		for _, col := range []string{"description", "industry", "sub_industry", "headquarters", "date_incorporated"} {
+			if rec.Has(col) {
+				sets = append(sets, col+`=EXCLUDED.`+col)
+			}
+		}
+		var inserted bool
+		err = tx.QueryRowContext(ctx, `INSERT INTO company (name, description, industry, sub_industry, headquarters, date_incorporated, user_id)
+			VALUES ($1, NULLIF($2,''), NULLIF($3,''), NULLIF($4,''), NULLIF($5,''), NULLIF($6,'')::date, $7)
+			ON CONFLICT (name) DO UPDATE SET `+strings.Join(sets, ", ")+`
+			RETURNING id, xmax = 0`,
+			rec.Name, rec.Description, rec.Industry, rec.SubIndustry, rec.Headquarters, rec.DateIncorporated, userID).Scan(&ids[i], &inserted)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			res.Created++
+		} else {
+			res.Updated++
+		}
+	}
+
+	// Detach every record that supplies a parent first so cycles are judged
+	// against the hierarchy the import describes rather than the one it
+	// replaces.
+	var reparented []int
+	for i, rec := range recs {
+		if rec.Has("parent") {
+			reparented = append(reparented, ids[i])
 		}
-		if dt.Valid {
-			d := dt.Time.Format("2006-01-02")
-			c.DateIncorporated = &d
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE company SET parent_company_id=NULL WHERE id = ANY($1)`, reparented); err != nil {
+		return nil, err
+	}
+	for i, rec := range recs {
+		if rec.Parent == "" || ids[i] == 0 {
+			continue
+		}
+		var parentID int
+		err := tx.QueryRowContext(ctx, `SELECT id FROM company WHERE name=$1`, rec.Parent).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			res.Errors = append(res.Errors, catalog.RowError{Line: rec.Line, Field: "parent", Code: "not_found", Message: "no company is named " + strconv.Quote(rec.Parent)})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var cycle bool
+		if err := tx.QueryRowContext(ctx, `SELECT $2::int IN `+companySubtree(`$1`), ids[i], parentID).Scan(&cycle); err != nil {
+			return nil, err
+		}
+		if cycle {
+			res.Errors = append(res.Errors, catalog.RowError{Line: rec.Line, Field: "parent", Code: "cycle", Message: strconv.Quote(rec.Parent) + " is already a subsidiary of " + strconv.Quote(rec.Name)})
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE company SET parent_company_id=$1 WHERE id=$2`, parentID, ids[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun || len(res.Errors) > 0 {
+		return res, nil
+	}
+	return res, tx.Commit()
+}
+
+// otherCompany returns the first match that is not the company named exactly
+// name.
+func otherCompany(matches []*models.CompanyMatch, name string) *models.CompanyMatch {
+	for _, m := range matches {
+		if m.Company.Name != name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Export calls fn with every company in id order, naming its parent.
+func (r *CompanyRepo) Export(ctx context.Context, fn func(*catalog.Record) error) error {
+	rows, err := r.db.QueryContext(ctx, `SELECT c.name, COALESCE(c.description, ''), COALESCE(c.industry, ''), COALESCE(c.sub_industry, ''),
+		COALESCE(c.headquarters, ''), COALESCE(to_char(c.date_incorporated, 'YYYY-MM-DD'), ''), COALESCE(p.name, '')
+		FROM company c LEFT JOIN company p ON p.id = c.parent_company_id ORDER BY c.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec catalog.Record
+		if err := rows.Scan(&rec.Name, &rec.Description, &rec.Industry, &rec.SubIndustry, &rec.Headquarters, &rec.DateIncorporated, &rec.Parent); err != nil {
+			return err
 		}
-		if uid.Valid {
-			u := int(uid.Int32)
-			c.UserID = &u
+		if err := fn(&rec); err != nil {
+			return err
 		}
-		out = append(out, &c)
 	}
-	return out, nil
+	return rows.Err()
 }
@@ -0,0 +1,225 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+var ErrCompensationExists = errors.New("you already reported pay at this company this year")
+
+type CompensationRepo struct{ db *sql.DB }
+
+func NewCompensationRepo(db *sql.DB) *CompensationRepo { return &CompensationRepo{db: db} }
+
+const compensationColumns = `id, company_id, user_id, submission_year, title, level, location, years_experience, currency, base_salary, bonus, equity, created_at`
+
+func scanCompensation(row rowScanner) (*models.Compensation, error) {
+	var s models.Compensation
+	if err := row.Scan(&s.ID, &s.CompanyID, &s.UserID, &s.Year, &s.Title, &s.Level, &s.Location, &s.YearsExperience,
+		&s.Currency, &s.BaseSalary, &s.Bonus, &s.Equity, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Create stores a submission, returning ErrCompensationExists when the user
+// already reported pay at the company this year.
+func (r *CompensationRepo) Create(ctx context.Context, s *models.Compensation) error {
+	err := r.db.QueryRowContext(ctx, `INSERT INTO compensation (company_id, user_id, title, level, location, years_experience, currency, base_salary, bonus, equity)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id, submission_year, created_at`,
+		s.CompanyID, s.UserID, s.Title, s.Level, s.Location, s.YearsExperience, s.Currency, s.BaseSalary, s.Bonus, s.Equity).Scan(&s.ID, &s.Year, &s.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrCompensationExists
+	}
+	return err
+}
+
+var compensationByID = keyset{name: "id", exprs: []string{`id`}, kinds: []keyKind{keyInt}}
+
+// PageByUser returns one page of a user's submissions, oldest first.
+func (r *CompensationRepo) PageByUser(ctx context.Context, userID int, p Page) ([]*models.Compensation, string, error) {
+	q := pageQuery{columns: compensationColumns, from: `FROM compensation`}
+	q.where = append(q.where, `user_id = `+q.arg(userID))
+	return listPage(ctx, r.db, q, compensationByID, p, scanCompensation)
+}
+
+// ListByUser returns every submission a user made.
+func (r *CompensationRepo) ListByUser(ctx context.Context, userID int) ([]*models.Compensation, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+compensationColumns+` FROM compensation WHERE user_id=$1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Compensation
+	for rows.Next() {
+		s, err := scanCompensation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Delete removes one of userID's submissions. It returns sql.ErrNoRows when
+// the user has no such submission.
+func (r *CompensationRepo) Delete(ctx context.Context, id, userID int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM compensation WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Groupings accepted by CompensationQuery.GroupBy.
+const (
+	CompensationByCompany  = "company"
+	CompensationByTitle    = "title"
+	CompensationByLevel    = "level"
+	CompensationByLocation = "location"
+)
+
+// ValidCompensationGroup reports whether g is accepted by Stats.
+func ValidCompensationGroup(g string) bool {
+	switch g {
+	case CompensationByCompany, CompensationByTitle, CompensationByLevel, CompensationByLocation:
+		return true
+	}
+	return false
+}
+
+// CompensationMinUsers is the smallest group Stats reports. With fewer
+// submitters the quartiles are little more than individual salaries.
+const CompensationMinUsers = 10
+
+// compensationRounding is the step amounts are rounded to before and after
+// aggregating, so no percentile repeats an exact submission.
+const compensationRounding = 1000
+
+// maxCompensationGroups caps how many groups Stats returns, largest first.
+const maxCompensationGroups = 200
+
+// CompensationQuery selects and groups the submissions Stats aggregates.
+// Empty filters are ignored; text filters ignore case.
+type CompensationQuery struct {
+	CompanyID int
+	// IncludeSubsidiaries rolls up pay at every company below CompanyID.
+	IncludeSubsidiaries bool
+	Title               string
+	Level               string
+	Location            string
+	Currency            string
+	GroupBy             []string
+	// MinUsers hides groups with fewer distinct submitters. Values below
+	// CompensationMinUsers are raised to it.
+	MinUsers int
+}
+
+// Stats returns pay percentiles per group. Groups are always split by
+// currency, and text fields are grouped case-insensitively and shown in their
+// most common spelling. Amounts are rounded to the nearest
+// compensationRounding and groups need at least CompensationMinUsers distinct
+// submitters.
+func (r *CompensationRepo) Stats(ctx context.Context, q CompensationQuery) ([]*models.CompensationStats, error) {
+	if q.MinUsers < CompensationMinUsers {
+		q.MinUsers = CompensationMinUsers
+	}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	var where []string
+	if q.CompanyID != 0 {
+		if q.IncludeSubsidiaries {
+			where = append(where, `s.company_id IN `+companySubtree(arg(q.CompanyID)))
+		} else {
+			where = append(where, `s.company_id = `+arg(q.CompanyID))
+		}
+	}
+	for _, f := range []struct{ col, v string }{
+		{`s.title`, q.Title},
+		{`s.level`, q.Level},
+		{`s.location`, q.Location},
+		{`s.currency`, q.Currency},
+	} {
+		if f.v != "" {
+			where = append(where, `lower(`+f.col+`) = lower(`+arg(f.v)+`)`)
+		}
+	}
+
+	var cols, keys []string
+	for _, g := range q.GroupBy {
+		switch g {
+		case CompensationByCompany:
+			cols = append(cols, `s.company_id`, `min(c.name)`)
+			keys = append(keys, `s.company_id`)
+		case CompensationByTitle, CompensationByLevel, CompensationByLocation:
+			cols = append(cols, `mode() WITHIN GROUP (ORDER BY s.`+g+`)`)
+			keys = append(keys, `lower(s.`+g+`)`)
+		}
+	}
+	cols = append(cols, `s.currency`, `count(*)`)
+	keys = append(keys, `s.currency`)
+	step := strconv.Itoa(compensationRounding)
+	// Each amount fits an integer but their sum may not
+	for _, amount := range []string{`s.base_salary`, `s.bonus`, `s.equity`, `s.base_salary::bigint + s.bonus + s.equity`} {
+		rounded := `round((` + amount + `) / ` + step + `.0) * ` + step
+		for _, p := range []string{`0.25`, `0.5`, `0.75`} {
+			cols = append(cols, `round(percentile_cont(`+p+`) WITHIN GROUP (ORDER BY `+rounded+`) / `+step+`) * `+step)
+		}
+	}
+
+	query := `SELECT ` + strings.Join(cols, `, `) + ` FROM compensation s JOIN company c ON c.id = s.company_id`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` GROUP BY ` + strings.Join(keys, `, `) +
+		` HAVING count(DISTINCT s.user_id) >= ` + arg(q.MinUsers) +
+		` ORDER BY count(*) DESC, ` + strings.Join(keys, `, `) +
+		` LIMIT ` + strconv.Itoa(maxCompensationGroups)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*models.CompensationStats{}
+	for rows.Next() {
+		var st models.CompensationStats
+		var dests []interface{}
+		for _, g := range q.GroupBy {
+			switch g {
+			case CompensationByCompany:
+				dests = append(dests, &st.CompanyID, &st.CompanyName)
+			case CompensationByTitle:
+				dests = append(dests, &st.Title)
+			case CompensationByLevel:
+				dests = append(dests, &st.Level)
+			case CompensationByLocation:
+				dests = append(dests, &st.Location)
+			}
+		}
+		dests = append(dests, &st.Currency, &st.Count)
+		for _, p := range []*models.Percentiles{&st.Base, &st.Bonus, &st.Equity, &st.Total} {
+			dests = append(dests, &p.P25, &p.P50, &p.P75)
+		}
+		if err := rows.Scan(dests...); err != nil {
+			return nil, err
+		}
+		out = append(out, &st)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/brennanromance/heard/internal/db"
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// testDB connects to the database named by HEARD_TEST_DATABASE_URL and loads
+// database_setup.sql into it, wiping whatever it held. Tests that need a
+// database are skipped when the variable is unset.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("HEARD_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("HEARD_TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	sqlDB, err := db.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	schema, err := os.ReadFile("../../database_setup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlDB.ExecContext(ctx, string(schema)); err != nil {
+		t.Fatalf("loading schema: %v", err)
+	}
+	return sqlDB
+}
+
+func TestCompensationStatsExtremeAmounts(t *testing.T) {
+	sqlDB := testDB(t)
+	ctx := context.Background()
+	users, companies, pay := NewUserRepo(sqlDB), NewCompanyRepo(sqlDB), NewCompensationRepo(sqlDB)
+	c := &models.Company{Name: "Acme"}
+	if err := companies.Create(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < CompensationMinUsers; i++ {
+		u := &models.User{Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i), Password: "correct horse battery"}
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		s := &models.Compensation{CompanyID: c.ID, UserID: u.ID, Title: "Engineer", Currency: "USD",
+			BaseSalary: math.MaxInt32, Bonus: math.MaxInt32, Equity: math.MaxInt32}
+		if err := pay.Create(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := pay.Stats(ctx, CompensationQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d groups, want 1", len(stats))
+	}
+	if want := 6442451000.0; stats[0].Total.P50 != want {
+		t.Errorf("total p50 = %v, want %v", stats[0].Total.P50, want)
+	}
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// staleErasureAfter is how long a running erasure may go without finishing
+// before another worker picks it up again.
+const staleErasureAfter = 15 * time.Minute
+
+var ErrErasureInProgress = errors.New("account erasure already requested")
+
+type ErasureRepo struct{ db *sql.DB }
+
+func NewErasureRepo(db *sql.DB) *ErasureRepo { return &ErasureRepo{db: db} }
+
+// Create queues the erasure of a user's account. The account is disabled,
+// signed out and its API keys revoked straight away; the data itself is
+// scrubbed by ProcessPending.
+func (r *ErasureRepo) Create(ctx context.Context, e *models.ErasureRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO erasure_request (id, user_id) VALUES ($1,$2) RETURNING status, requested_at`, e.ID, e.UserID).Scan(&e.Status, &e.RequestedAt)
+	if isUniqueViolation(err) {
+		return ErrErasureInProgress
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET deleted_at=now() WHERE id=$1`, e.UserID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE auth_session SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, e.UserID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE api_key SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, e.UserID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ErasureRepo) Get(ctx context.Context, id string) (*models.ErasureRequest, error) {
+	var e models.ErasureRequest
+	var errMsg sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT id, user_id, status, error, requested_at, completed_at FROM erasure_request WHERE id=$1`, id).Scan(&e.ID, &e.UserID, &e.Status, &errMsg, &e.RequestedAt, &e.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.Error = errMsg.String
+	return &e, nil
+}
+
+// ProcessPending erases every queued account and returns how many were
+// completed. A failing request is marked failed and left for an operator.
+func (r *ErasureRepo) ProcessPending(ctx context.Context) (int, error) {
+	done := 0
+	for {
+		var id string
+		var userID int
+		err := r.db.QueryRowContext(ctx, `UPDATE erasure_request SET status='running', started_at=now()
+			WHERE id = (SELECT id FROM erasure_request
+				WHERE status='pending' OR (status='running' AND started_at < $1)
+				ORDER BY requested_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+			RETURNING id, user_id`, time.Now().Add(-staleErasureAfter)).Scan(&id, &userID)
+		if err == sql.ErrNoRows {
+			return done, nil
+		}
+		if err != nil {
+			return done, err
+		}
+		if err := r.erase(ctx, id, userID); err != nil {
+			if _, ferr := r.db.ExecContext(ctx, `UPDATE erasure_request SET status='failed', error=$2 WHERE id=$1`, id, err.Error()); ferr != nil {
+				return done, ferr
+			}
+			return done, err
+		}
+		done++
+	}
+}
+
+// erase scrubs the account's personal data. Posts and comments stay so that
+// threads remain readable; they are shown with a "[deleted user]" author.
+func (r *ErasureRepo) erase(ctx context.Context, id string, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		`UPDATE users SET username='deleted-'||id||'-'||substr(md5(random()::text), 1, 8),
+			email='deleted-'||id||'-'||substr(md5(random()::text), 1, 8)||'@invalid', password='', role='user',
+			email_verified=false, totp_secret=NULL, totp_enabled=false, totp_last_counter=NULL,
+			deleted_at=COALESCE(deleted_at, now()) WHERE id=$1`,
+		`UPDATE auth_session SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`,
+		`DELETE FROM refresh_token WHERE user_id=$1`,
+		`DELETE FROM user_token WHERE user_id=$1`,
+		`DELETE FROM user_identity WHERE user_id=$1`,
+		`DELETE FROM api_key WHERE user_id=$1`,
+		`DELETE FROM mfa_recovery_code WHERE user_id=$1`,
+		`DELETE FROM company_role WHERE user_id=$1`,
+		`DELETE FROM affiliation_challenge WHERE user_id=$1`,
+		`DELETE FROM user_company_affiliation WHERE user_id=$1`,
+		`DELETE FROM pseudonym WHERE user_id=$1`,
+		`DELETE FROM post_likes WHERE user_id=$1`,
+		`DELETE FROM comment_likes WHERE user_id=$1`,
+		`DELETE FROM compensation WHERE user_id=$1`,
+		`DELETE FROM company_follow WHERE user_id=$1`,
+		`UPDATE company SET user_id=NULL WHERE user_id=$1`,
+		`UPDATE deanonymization_log SET user_id=NULL WHERE user_id=$1`,
+	}
+	for _, q := range stmts {
+		if _, err := tx.ExecContext(ctx, q, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE erasure_request SET status='completed', error=NULL, completed_at=now() WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+type FollowRepo struct{ db *sql.DB }
+
+func NewFollowRepo(db *sql.DB) *FollowRepo { return &FollowRepo{db: db} }
+
+// followedCompanies returns a subquery selecting the companies the user bound
+// to param follows, plus every company below the follows that include
+// subsidiaries. UNION discards rows already seen, so cycles end the
+// recursion.
+func followedCompanies(param string) string {
+	return `(WITH RECURSIVE followed(id, deep) AS (
+		SELECT f.company_id, f.include_subsidiaries FROM company_follow f WHERE f.user_id = ` + param + `
+		UNION
+		SELECT c.id, true FROM company c JOIN followed fc ON c.parent_company_id = fc.id WHERE fc.deep
+	) SELECT id FROM followed)`
+}
+
+// Follow starts following a company, or changes whether an existing follow
+// includes subsidiaries.
+func (r *FollowRepo) Follow(ctx context.Context, f *models.CompanyFollow) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO company_follow (user_id, company_id, include_subsidiaries) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id, company_id) DO UPDATE SET include_subsidiaries=EXCLUDED.include_subsidiaries
+		RETURNING created_at`, f.UserID, f.CompanyID, f.IncludeSubsidiaries).Scan(&f.CreatedAt)
+}
+
+// Unfollow stops following a company, returning sql.ErrNoRows when the user
+// did not follow it.
+func (r *FollowRepo) Unfollow(ctx context.Context, userID, companyID int) error {
+	return deleteOne(ctx, r.db, `DELETE FROM company_follow WHERE user_id=$1 AND company_id=$2`, userID, companyID)
+}
+
+var followsNewest = keyset{name: "new", exprs: []string{`f.created_at`, `f.id`}, kinds: []keyKind{keyTime, keyInt}, desc: true}
+
+// PageByUser returns one page of the companies a user follows, most recently
+// followed first.
+func (r *FollowRepo) PageByUser(ctx context.Context, userID int, p Page) ([]*models.CompanyFollow, string, error) {
+	q := pageQuery{
+		columns: companyColumns + `, f.include_subsidiaries, f.created_at`,
+		from:    companyFrom + ` JOIN company_follow f ON f.company_id = c.id`,
+	}
+	q.where = append(q.where, `f.user_id = `+q.arg(userID))
+	return listPage(ctx, r.db, q, followsNewest, p, func(row rowScanner) (*models.CompanyFollow, error) {
+		f := models.CompanyFollow{UserID: userID}
+		c, err := scanCompany(keyScanner{row: row, keys: []interface{}{&f.IncludeSubsidiaries, &f.CreatedAt}})
+		if err != nil {
+			return nil, err
+		}
+		f.CompanyID = c.ID
+		f.Company = c
+		return &f, nil
+	})
+}
+
+// ListByUser returns the companies a user follows, most recent follow first.
+func (r *FollowRepo) ListByUser(ctx context.Context, userID int) ([]*models.CompanyFollow, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+companyColumns+`, f.include_subsidiaries, f.created_at `+companyFrom+`
+		JOIN company_follow f ON f.company_id = c.id WHERE f.user_id=$1 ORDER BY f.created_at DESC, f.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*models.CompanyFollow{}
+	for rows.Next() {
+		f := models.CompanyFollow{UserID: userID}
+		c, err := scanCompany(keyScanner{row: rows, keys: []interface{}{&f.IncludeSubsidiaries, &f.CreatedAt}})
+		if err != nil {
+			return nil, err
+		}
+		f.CompanyID = c.ID
+		f.Company = c
+		out = append(out, &f)
+	}
+	return out, rows.Err()
+}
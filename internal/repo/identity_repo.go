@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+var ErrLoginStateInvalid = errors.New("invalid or expired login state")
+
+type IdentityRepo struct{ db *sql.DB }
+
+func NewIdentityRepo(db *sql.DB) *IdentityRepo { return &IdentityRepo{db: db} }
+
+// FindUser returns the id of the active user linked to subject at provider.
+func (r *IdentityRepo) FindUser(ctx context.Context, provider, subject string) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, `SELECT i.user_id FROM user_identity i JOIN users u ON u.id = i.user_id
+		WHERE i.provider=$1 AND i.subject=$2 AND u.deleted_at IS NULL`, provider, subject).Scan(&userID)
+	return userID, err
+}
+
+func (r *IdentityRepo) Link(ctx context.Context, i *models.Identity) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO user_identity (user_id, provider, subject, email) VALUES ($1,$2,$3,NULLIF($4,'')) RETURNING id, created_at`, i.UserID, i.Provider, i.Subject, i.Email).Scan(&i.ID, &i.CreatedAt)
+}
+
+func (r *IdentityRepo) ListForUser(ctx context.Context, userID int) ([]*models.Identity, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at FROM user_identity WHERE user_id=$1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Identity
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &i)
+	}
+	return out, rows.Err()
+}
+
+// CreateLoginState remembers the nonce and PKCE verifier of a sign-in that was
+// sent to provider.
+func (r *IdentityRepo) CreateLoginState(ctx context.Context, stateHash, provider, nonce, verifier string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO oidc_login_state (state_hash, provider, nonce, code_verifier, expires_at) VALUES ($1,$2,$3,$4,$5)`, stateHash, provider, nonce, verifier, expiresAt)
+	return err
+}
+
+// ConsumeLoginState deletes and returns the nonce and verifier for a state.
+// Each state can be used once.
+func (r *IdentityRepo) ConsumeLoginState(ctx context.Context, stateHash, provider string) (nonce, verifier string, err error) {
+	var expiresAt time.Time
+	err = r.db.QueryRowContext(ctx, `DELETE FROM oidc_login_state WHERE state_hash=$1 AND provider=$2 RETURNING nonce, code_verifier, expires_at`, stateHash, provider).Scan(&nonce, &verifier, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return "", "", ErrLoginStateInvalid
+	}
+	return nonce, verifier, err
+}
+
+// PurgeExpiredLoginStates drops sign-ins that were never completed.
+func (r *IdentityRepo) PurgeExpiredLoginStates(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_state WHERE expires_at < now()`)
+	return err
+}
@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+type InterviewRepo struct{ db *sql.DB }
+
+func NewInterviewRepo(db *sql.DB) *InterviewRepo { return &InterviewRepo{db: db} }
+
+// interviewSelect lists interview columns, the author's pseudonym for the
+// company and whether the author is a verified employee of it.
+const (
+	interviewColumns = `i.id, i.company_id, i.user_id,
+	CASE WHEN u.deleted_at IS NOT NULL THEN '[deleted user]' ELSE COALESCE(ps.name, 'Anonymous') END,
+	i.role, i.interview_date, i.outcome, i.difficulty, i.stages, i.questions,
+	EXISTS(SELECT 1 FROM user_company_affiliation a WHERE a.user_id = i.user_id AND a.company_id = i.company_id),
+	i.created_at, i.updated_at, u.deleted_at IS NOT NULL`
+	interviewFrom = `FROM interview i
+	JOIN users u ON u.id = i.user_id
+	LEFT JOIN pseudonym ps ON ps.user_id = i.user_id AND ps.company_id = i.company_id`
+	interviewSelect = `SELECT ` + interviewColumns + ` ` + interviewFrom
+)
+
+func scanInterview(row rowScanner) (*models.Interview, error) {
+	var iv models.Interview
+	var date time.Time
+	var stages []byte
+	if err := row.Scan(&iv.ID, &iv.CompanyID, &iv.UserID, &iv.Author,
+		&iv.Role, &date, &iv.Outcome, &iv.Difficulty, &stages, &iv.Questions,
+		&iv.VerifiedEmployee, &iv.CreatedAt, &iv.UpdatedAt, &iv.AuthorDeleted); err != nil {
+		return nil, err
+	}
+	iv.Date = date.Format("2006-01-02")
+	if err := json.Unmarshal(stages, &iv.Stages); err != nil {
+		return nil, err
+	}
+	return &iv, nil
+}
+
+func stagesJSON(stages []string) (string, error) {
+	if stages == nil {
+		stages = []string{}
+	}
+	b, err := json.Marshal(stages)
+	return string(b), err
+}
+
+func (r *InterviewRepo) Create(ctx context.Context, iv *models.Interview) error {
+	stages, err := stagesJSON(iv.Stages)
+	if err != nil {
+		return err
+	}
+	return r.db.QueryRowContext(ctx, `INSERT INTO interview (company_id, user_id, role, interview_date, outcome, difficulty, stages, questions)
+		VALUES ($1,$2,$3,$4,$5,$6,$7::jsonb,$8) RETURNING id`,
+		iv.CompanyID, iv.UserID, iv.Role, iv.Date, iv.Outcome, iv.Difficulty, stages, iv.Questions).Scan(&iv.ID)
+}
+
+func (r *InterviewRepo) GetByID(ctx context.Context, id int) (*models.Interview, error) {
+	return scanInterview(r.db.QueryRowContext(ctx, interviewSelect+` WHERE i.id=$1`, id))
+}
+
+// Update rewrites a report. The company and author never change.
+func (r *InterviewRepo) Update(ctx context.Context, iv *models.Interview) error {
+	stages, err := stagesJSON(iv.Stages)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE interview SET role=$1, interview_date=$2, outcome=$3, difficulty=$4, stages=$5::jsonb, questions=$6 WHERE id=$7`,
+		iv.Role, iv.Date, iv.Outcome, iv.Difficulty, stages, iv.Questions, iv.ID)
+	return err
+}
+
+func (r *InterviewRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM interview WHERE id=$1`, id)
+	return err
+}
+
+// InterviewFilter narrows ListForCompany and Summary. Empty fields are
+// ignored; Role matches anywhere in the role, ignoring case.
+type InterviewFilter struct {
+	CompanyID int
+	// IncludeSubsidiaries rolls up reports about every company below
+	// CompanyID.
+	IncludeSubsidiaries bool
+	Role                string
+	Outcome             string
+	MinDifficulty       int
+	MaxDifficulty       int
+	After               *time.Time
+	Before              *time.Time
+}
+
+func (f InterviewFilter) where(arg func(interface{}) string) []string {
+	var where []string
+	if f.IncludeSubsidiaries {
+		where = append(where, `i.company_id IN `+companySubtree(arg(f.CompanyID)))
+	} else {
+		where = append(where, `i.company_id = `+arg(f.CompanyID))
+	}
+	if f.Role != "" {
+		where = append(where, `i.role ILIKE '%' || `+arg(escapeLike(f.Role))+` || '%'`)
+	}
+	if f.Outcome != "" {
+		where = append(where, `i.outcome = `+arg(f.Outcome))
+	}
+	if f.MinDifficulty != 0 {
+		where = append(where, `i.difficulty >= `+arg(f.MinDifficulty))
+	}
+	if f.MaxDifficulty != 0 {
+		where = append(where, `i.difficulty <= `+arg(f.MaxDifficulty))
+	}
+	if f.After != nil {
+		where = append(where, `i.interview_date >= `+arg(*f.After))
+	}
+	if f.Before != nil {
+		where = append(where, `i.interview_date <= `+arg(*f.Before))
+	}
+	return where
+}
+
+var interviewsNewest = keyset{name: "date", exprs: []string{`i.interview_date`, `i.id`}, kinds: []keyKind{keyTime, keyInt}, desc: true}
+
+// ListForCompany returns one page of the reports matching f, most recent
+// interview first.
+func (r *InterviewRepo) ListForCompany(ctx context.Context, f InterviewFilter, p Page) ([]*models.Interview, string, error) {
+	q := pageQuery{columns: interviewColumns, from: interviewFrom}
+	q.where = f.where(q.arg)
+	return listPage(ctx, r.db, q, interviewsNewest, p, scanInterview)
+}
+
+// Summary counts outcomes and averages difficulty over the reports matching
+// f.
+func (r *InterviewRepo) Summary(ctx context.Context, f InterviewFilter) (*models.InterviewSummary, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := f.where(arg)
+	var s models.InterviewSummary
+	err := r.db.QueryRowContext(ctx, `SELECT count(*),
+		count(*) FILTER (WHERE i.outcome = 'offer'),
+		count(*) FILTER (WHERE i.outcome = 'reject'),
+		count(*) FILTER (WHERE i.outcome = 'no_response'),
+		round(avg((i.outcome = 'offer')::int), 3)::float8,
+		round(avg(i.difficulty), 2)::float8
+		FROM interview i WHERE `+strings.Join(where, ` AND `), args...).
+		Scan(&s.Count, &s.Offers, &s.Rejections, &s.NoResponse, &s.OfferRate, &s.AverageDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListByUser returns every report a user wrote.
+func (r *InterviewRepo) ListByUser(ctx context.Context, userID int) ([]*models.Interview, error) {
+	rows, err := r.db.QueryContext(ctx, interviewSelect+` WHERE i.user_id=$1 ORDER BY i.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Interview
+	for rows.Next() {
+		iv, err := scanInterview(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, iv)
+	}
+	return out, rows.Err()
+}
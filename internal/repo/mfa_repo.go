@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+)
+
+// MFARepo stores TOTP secrets and recovery codes.
+type MFARepo struct{ db *sql.DB }
+
+func NewMFARepo(db *sql.DB) *MFARepo { return &MFARepo{db: db} }
+
+// TOTP returns the user's secret (empty when none) and whether it is enabled.
+func (r *MFARepo) TOTP(ctx context.Context, userID int) (string, bool, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := r.db.QueryRowContext(ctx, `SELECT totp_secret, totp_enabled FROM users WHERE id=$1`, userID).Scan(&secret, &enabled)
+	return secret.String, enabled, err
+}
+
+// SetPendingTOTP stores a secret that becomes active once Enable is called,
+// along with a fresh set of recovery codes.
+func (r *MFARepo) SetPendingTOTP(ctx context.Context, userID int, secret string, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET totp_secret=$1, totp_enabled=false, totp_last_counter=NULL WHERE id=$2`, secret, userID); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MFARepo) Enable(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET totp_enabled=true WHERE id=$1 AND totp_secret IS NOT NULL`, userID)
+	return err
+}
+
+// Disable removes the secret and every recovery code.
+func (r *MFARepo) Disable(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET totp_secret=NULL, totp_enabled=false, totp_last_counter=NULL WHERE id=$1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_code WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseCounter records that the code for time step counter was accepted. It
+// returns false if that step (or a later one) was already used, which stops
+// a code from being replayed within its validity window.
+func (r *MFARepo) UseCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET totp_last_counter=$1 WHERE id=$2 AND (totp_last_counter IS NULL OR totp_last_counter < $1)`, counter, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *MFARepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode consumes a recovery code, returning false if it doesn't
+// exist or was already used.
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE mfa_recovery_code SET used_at=now() WHERE id = (
+		SELECT id FROM mfa_recovery_code WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL LIMIT 1)`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes.
+func (r *MFARepo) RemainingRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM mfa_recovery_code WHERE user_id=$1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_code WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_code (user_id, code_hash) VALUES ($1,$2)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
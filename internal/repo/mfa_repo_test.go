@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+func TestMFAUseCounterRejectsReplay(t *testing.T) {
+	sqlDB := testDB(t)
+	ctx := context.Background()
+	u := &models.User{Username: "ada", Email: "ada@example.com", Password: "correct horse battery"}
+	if err := NewUserRepo(sqlDB).Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	mfa := NewMFARepo(sqlDB)
+	for _, step := range []struct {
+		counter int64
+		want    bool
+	}{
+		{100, true},
+		{100, false}, // the same code again
+		{99, false},  // an older code
+		{101, true},
+	} {
+		ok, err := mfa.UseCounter(ctx, u.ID, step.counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != step.want {
+			t.Errorf("UseCounter(%d) = %v, want %v", step.counter, ok, step.want)
+		}
+	}
+}
+
+func TestMFARemainingRecoveryCodes(t *testing.T) {
+	sqlDB := testDB(t)
+	ctx := context.Background()
+	u := &models.User{Username: "ada", Email: "ada@example.com", Password: "correct horse battery"}
+	if err := NewUserRepo(sqlDB).Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	mfa := NewMFARepo(sqlDB)
+	if err := mfa.SetPendingTOTP(ctx, u.ID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := mfa.UseRecoveryCode(ctx, u.ID, "b"); err != nil || !ok {
+		t.Fatalf("UseRecoveryCode = %v, %v", ok, err)
+	}
+	if ok, err := mfa.UseRecoveryCode(ctx, u.ID, "b"); err != nil || ok {
+		t.Fatalf("reused recovery code: %v, %v", ok, err)
+	}
+	n, err := mfa.RemainingRecoveryCodes(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("remaining = %d, want 2", n)
+	}
+}
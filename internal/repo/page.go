@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes applied by the paginated List methods.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects one page of a list. Cursor is the next cursor returned with the
+// previous page and is empty for the first one.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+func (p Page) size() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultPageSize
+	case p.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return p.Limit
+}
+
+type keyKind int
+
+const (
+	keyInt keyKind = iota
+	keyString
+	keyTime
+	keyFloat
+)
+
+func (k keyKind) dest() interface{} {
+	switch k {
+	case keyString:
+		return new(string)
+	case keyTime:
+		return new(time.Time)
+	case keyFloat:
+		return new(float64)
+	}
+	return new(int64)
+}
+
+// keyset is an ordering lists can be paged through without OFFSET. Every
+// expression must be non-null and together they must be unique, so the last
+// one is normally the primary key. All keys sort in the same direction, which
+// lets the cursor condition be a single row comparison.
+type keyset struct {
+	name  string
+	exprs []string
+	kinds []keyKind
+	desc  bool
+}
+
+type cursorData struct {
+	Order string            `json:"o"`
+	Keys  []json.RawMessage `json:"k"`
+}
+
+func (k keyset) orderBy() string {
+	parts := make([]string, len(k.exprs))
+	for i, e := range k.exprs {
+		parts[i] = e
+		if k.desc {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// after returns the condition selecting the rows that follow cursor, or ""
+// on the first page. Cursors issued for another ordering are rejected.
+func (k keyset) after(cursor string, arg func(interface{}) string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	var c cursorData
+	if err := json.Unmarshal(raw, &c); err != nil || c.Order != k.name || len(c.Keys) != len(k.exprs) {
+		return "", ErrInvalidCursor
+	}
+	params := make([]string, len(c.Keys))
+	for i, kind := range k.kinds {
+		dst := kind.dest()
+		if err := json.Unmarshal(c.Keys[i], dst); err != nil {
+			return "", ErrInvalidCursor
+		}
+		switch v := dst.(type) {
+		case *int64:
+			params[i] = arg(*v)
+		case *string:
+			params[i] = arg(*v)
+		case *time.Time:
+			params[i] = arg(*v)
+		case *float64:
+			params[i] = arg(*v)
+		}
+	}
+	op := " > "
+	if k.desc {
+		op = " < "
+	}
+	return "(" + strings.Join(k.exprs, ", ") + ")" + op + "(" + strings.Join(params, ", ") + ")", nil
+}
+
+func (k keyset) encode(keys []interface{}) (string, error) {
+	c := cursorData{Order: k.name, Keys: make([]json.RawMessage, len(keys))}
+	for i, v := range keys {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		c.Keys[i] = b
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// keyScanner appends the keyset columns to whatever a scan helper reads, so
+// the usual scanX functions work on paginated queries unchanged.
+type keyScanner struct {
+	row  rowScanner
+	keys []interface{}
+}
+
+func (s keyScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.keys...)...)
+}
+
+// pageQuery describes a paginated SELECT. where holds conditions already
+// rendered with arg.
+type pageQuery struct {
+	columns string
+	from    string
+	where   []string
+	args    []interface{}
+}
+
+func (q *pageQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// listPage runs q ordered by k and returns at most p.size() rows along with
+// the cursor for the next page, which is empty on the last one.
+func listPage[T any](ctx context.Context, db *sql.DB, q pageQuery, k keyset, p Page, scan func(rowScanner) (T, error)) ([]T, string, error) {
+	cond, err := k.after(p.Cursor, q.arg)
+	if err != nil {
+		return nil, "", err
+	}
+	if cond != "" {
+		q.where = append(q.where, cond)
+	}
+	size := p.size()
+	query := `SELECT ` + q.columns + `, ` + strings.Join(k.exprs, `, `) + ` ` + q.from
+	if len(q.where) > 0 {
+		query += ` WHERE ` + strings.Join(q.where, ` AND `)
+	}
+	query += ` ORDER BY ` + k.orderBy() + ` LIMIT ` + strconv.Itoa(size+1)
+
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	out := make([]T, 0, size)
+	var last []interface{}
+	for rows.Next() {
+		if len(out) == size {
+			next, err := k.encode(last)
+			return out, next, err
+		}
+		keys := make([]interface{}, len(k.kinds))
+		for i, kind := range k.kinds {
+			keys[i] = kind.dest()
+		}
+		v, err := scan(keyScanner{row: rows, keys: keys})
+		if err != nil {
+			return nil, "", err
+		}
+		out = append(out, v)
+		last = keys
+	}
+	return out, "", rows.Err()
+}
@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testKeyset = keyset{name: "new", exprs: []string{`p.created_at`, `p.id`}, kinds: []keyKind{keyTime, keyInt}, desc: true}
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	id := int64(42)
+	cursor, err := testKeyset.encode([]interface{}{&created, &id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	cond, err := testKeyset.after(cursor, arg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "(p.created_at, p.id) < ($1, $2)"; cond != want {
+		t.Errorf("condition = %q, want %q", cond, want)
+	}
+	if len(args) != 2 {
+		t.Fatalf("got %d args, want 2", len(args))
+	}
+	if got, ok := args[0].(time.Time); !ok || !got.Equal(created) {
+		t.Errorf("created_at arg = %v, want %v", args[0], created)
+	}
+	if got, ok := args[1].(int64); !ok || got != id {
+		t.Errorf("id arg = %v, want %d", args[1], id)
+	}
+}
+
+func TestCursorAscending(t *testing.T) {
+	k := keyset{name: "id", exprs: []string{`id`}, kinds: []keyKind{keyInt}}
+	id := int64(7)
+	cursor, err := k.encode([]interface{}{&id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond, err := k.after(cursor, func(interface{}) string { return "$1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "(id) > ($1)"; cond != want {
+		t.Errorf("condition = %q, want %q", cond, want)
+	}
+}
+
+func TestCursorFirstPage(t *testing.T) {
+	cond, err := testKeyset.after("", func(interface{}) string { t.Fatal("arg called"); return "" })
+	if err != nil || cond != "" {
+		t.Errorf("after(\"\") = %q, %v", cond, err)
+	}
+}
+
+func TestCursorRejected(t *testing.T) {
+	id := int64(1)
+	other, err := keyset{name: "id", exprs: []string{`id`}, kinds: []keyKind{keyInt}}.encode([]interface{}{&id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, tt := range []struct{ name, cursor string }{
+		{"not base64", "!!!"},
+		{"not json", enc("nope")},
+		{"other ordering", other},
+		{"wrong key count", enc(`{"o":"new","k":["2024-05-01T12:30:00Z"]}`)},
+		{"wrong key type", enc(`{"o":"new","k":["2024-05-01T12:30:00Z","42"]}`)},
+		{"sql in key", enc(`{"o":"new","k":["'; DROP TABLE post; --",1]}`)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testKeyset.after(tt.cursor, func(interface{}) string { return "$1" }); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("after = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for _, tt := range []struct{ limit, want int }{
+		{0, DefaultPageSize},
+		{-1, DefaultPageSize},
+		{10, 10},
+		{MaxPageSize + 1, MaxPageSize},
+	} {
+		if got := (Page{Limit: tt.limit}).size(); got != tt.want {
+			t.Errorf("Page{Limit: %d}.size() = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -11,10 +11,44 @@ type PostRepo struct{ db *sql.DB }
 
 func NewPostRepo(db *sql.DB) *PostRepo { return &PostRepo{db: db} }
 
+// postSelect lists post columns, the author's display name (their pseudonym
+// for the company when the post is anonymous) and whether the author is a
+// verified employee of the post's company.
+const (
+	postColumns = `p.id, p.title, p.description, p.company_id, p.user_id,
+	CASE WHEN u.deleted_at IS NOT NULL THEN '[deleted user]' WHEN p.anonymous THEN COALESCE(ps.name, 'Anonymous') ELSE u.username END,
+	p.anonymous, p.likes, p.created_at, p.updated_at,
+	EXISTS(SELECT 1 FROM user_company_affiliation a WHERE a.user_id = p.user_id AND a.company_id = p.company_id),
+	u.deleted_at IS NOT NULL`
+	postFrom = `FROM post p
+	JOIN users u ON u.id = p.user_id
+	LEFT JOIN pseudonym ps ON ps.user_id = p.user_id AND ps.company_id = p.company_id`
+	postSelect = `SELECT ` + postColumns + ` ` + postFrom
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPost(row rowScanner) (*models.Post, error) {
+	var p models.Post
+	var createdAt, updatedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.Title, &p.Description, &p.CompanyID, &p.UserID, &p.Author, &p.Anonymous, &p.Likes, &createdAt, &updatedAt, &p.VerifiedEmployee, &p.AuthorDeleted); err != nil {
+		return nil, err
+	}
+	if createdAt.Valid {
+		p.CreatedAt = createdAt.Time
+	}
+	if updatedAt.Valid {
+		p.UpdatedAt = updatedAt.Time
+	}
+	return &p, nil
+}
+
 func (r *PostRepo) Create(ctx context.Context, pModel *models.Post) error {
 	var id int
 	var createdAt, updatedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, `INSERT INTO post (title, description, company_id, user_id, likes) VALUES ($1,$2,$3,$4,$5) RETURNING id, created_at, updated_at`, pModel.Title, pModel.Description, pModel.CompanyID, pModel.UserID, pModel.Likes).Scan(&id, &createdAt, &updatedAt)
+	err := r.db.QueryRowContext(ctx, `INSERT INTO post (title, description, company_id, user_id, anonymous) VALUES ($1,$2,$3,$4,$5) RETURNING id, created_at, updated_at`, pModel.Title, pModel.Description, pModel.CompanyID, pModel.UserID, pModel.Anonymous).Scan(&id, &createdAt, &updatedAt)
 	if err != nil {
 		return err
 	}
@@ -28,62 +62,31 @@ func (r *PostRepo) Create(ctx context.Context, pModel *models.Post) error {
 	return nil
 }
 
-func (r *PostRepo) ToggleLike(ctx context.Context, userID, postID int) (bool, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return false, err
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
+// ToggleLike likes a post for userID, or takes the like back when there
+// already is one, and returns the new state with the post's like count.
+// Returns sql.ErrNoRows when the post does not exist.
+func (r *PostRepo) ToggleLike(ctx context.Context, userID, postID int) (bool, int, error) {
+	return toggleLike(ctx, r.db, "post", "post_likes", "post_id", userID, postID)
+}
 
-	var id int
-	err = tx.QueryRowContext(ctx, `SELECT id FROM post_likes WHERE user_id=$1 AND post_id=$2`, userID, postID).Scan(&id)
-	if err == sql.ErrNoRows {
-		if err = tx.QueryRowContext(ctx, `INSERT INTO post_likes (user_id, post_id) VALUES ($1,$2) RETURNING id`, userID, postID).Scan(&id); err != nil {
-			tx.Rollback()
-			return false, err
-		}
-		if err = tx.Commit(); err != nil {
-			return false, err
-		}
-		return true, nil
-	}
-	if err != nil {
-		tx.Rollback()
-		return false, err
-	}
-	if _, err = tx.ExecContext(ctx, `DELETE FROM post_likes WHERE id=$1`, id); err != nil {
-		tx.Rollback()
-		return false, err
-	}
-	if err = tx.Commit(); err != nil {
-		return false, err
-	}
-	return false, nil
+// LikedBy reports which of the posts in ids userID has liked.
+func (r *PostRepo) LikedBy(ctx context.Context, userID int, ids []int) (map[int]bool, error) {
+	return likedBy(ctx, r.db, `SELECT post_id FROM post_likes WHERE user_id=$1 AND post_id = ANY($2)`, userID, ids)
+}
+
+// ReconcileLikes recomputes every post's like count from post_likes and
+// returns how many counts were wrong.
+func (r *PostRepo) ReconcileLikes(ctx context.Context) (int64, error) {
+	return reconcileLikes(ctx, r.db, "post", "post_likes", "post_id")
 }
 
 func (r *PostRepo) GetByID(ctx context.Context, id int) (*models.Post, error) {
-	var p models.Post
-	var createdAt, updatedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, `SELECT id, title, description, company_id, user_id, likes, created_at, updated_at FROM post WHERE id=$1`, id).Scan(&p.ID, &p.Title, &p.Description, &p.CompanyID, &p.UserID, &p.Likes, &createdAt, &updatedAt)
-	if err != nil {
-		return nil, err
-	}
-	if createdAt.Valid {
-		p.CreatedAt = createdAt.Time
-	}
-	if updatedAt.Valid {
-		p.UpdatedAt = updatedAt.Time
-	}
-	return &p, nil
+	return scanPost(r.db.QueryRowContext(ctx, postSelect+` WHERE p.id=$1`, id))
 }
 
 func (r *PostRepo) Update(ctx context.Context, pModel *models.Post) error {
 	var updatedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, `UPDATE post SET title=$1, description=$2, company_id=$3, user_id=$4, likes=$5 WHERE id=$6 RETURNING updated_at`, pModel.Title, pModel.Description, pModel.CompanyID, pModel.UserID, pModel.Likes, pModel.ID).Scan(&updatedAt)
+	err := r.db.QueryRowContext(ctx, `UPDATE post SET title=$1, description=$2, company_id=$3, user_id=$4, anonymous=$5 WHERE id=$6 RETURNING updated_at, likes`, pModel.Title, pModel.Description, pModel.CompanyID, pModel.UserID, pModel.Anonymous, pModel.ID).Scan(&updatedAt, &pModel.Likes)
 	if err != nil {
 		return err
 	}
@@ -112,26 +115,180 @@ func (r *PostRepo) Delete(ctx context.Context, id int) error {
 	return tx.Commit()
 }
 
-func (r *PostRepo) List(ctx context.Context) ([]*models.Post, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, title, description, company_id, user_id, likes, created_at, updated_at FROM post ORDER BY id`)
+// postsNewest orders posts newest first.
+var postsNewest = keyset{name: "new", exprs: []string{`p.created_at`, `p.id`}, kinds: []keyKind{keyTime, keyInt}, desc: true}
+
+// PostFilter narrows List. Zero values are ignored.
+type PostFilter struct {
+	CompanyID int
+	// IncludeSubsidiaries rolls up posts about every company below CompanyID.
+	IncludeSubsidiaries bool
+}
+
+// List returns one page of the posts matching f, newest first.
+func (r *PostRepo) List(ctx context.Context, f PostFilter, p Page) ([]*models.Post, string, error) {
+	q := pageQuery{columns: postColumns, from: postFrom}
+	if f.CompanyID != 0 {
+		if f.IncludeSubsidiaries {
+			q.where = append(q.where, `p.company_id IN `+companySubtree(q.arg(f.CompanyID)))
+		} else {
+			q.where = append(q.where, `p.company_id = `+q.arg(f.CompanyID))
+		}
+	}
+	return listPage(ctx, r.db, q, postsNewest, p, scanPost)
+}
+
+// Feed orders accepted by Feed.
+const (
+	FeedSortHot = "hot"
+	FeedSortNew = "new"
+)
+
+// feedFrom adds each post's hot score, which blends recency and engagement:
+// every tenfold increase in likes plus twice the comments is worth as much as
+// 12.5 hours of age. The score never changes as time passes, so cursors stay
+// valid, though a post may move between pages as it gains engagement.
+const feedFrom = postFrom + `
+	CROSS JOIN LATERAL (SELECT log(greatest(
+		p.likes + 2 * (SELECT count(*) FROM comment cm WHERE cm.post_id = p.id), 1)::float8)
+		+ extract(epoch FROM p.created_at)::float8 / 45000 AS hot) e`
+
+var feedOrders = map[string]keyset{
+	FeedSortHot: {name: "hot", exprs: []string{`e.hot`, `p.id`}, kinds: []keyKind{keyFloat, keyInt}, desc: true},
+	FeedSortNew: postsNewest,
+}
+
+// ValidFeedSort reports whether sort is accepted by Feed.
+func ValidFeedSort(sort string) bool {
+	_, ok := feedOrders[sort]
+	return ok
+}
+
+// Feed returns one page of posts about the companies userID follows,
+// including subsidiaries of the follows that ask for them.
+func (r *PostRepo) Feed(ctx context.Context, userID int, sort string, p Page) ([]*models.Post, string, error) {
+	q := pageQuery{columns: postColumns, from: feedFrom}
+	q.where = append(q.where, `p.company_id IN `+followedCompanies(q.arg(userID)))
+	return listPage(ctx, r.db, q, feedOrders[sort], p, scanPost)
+}
+
+// ListByUser returns every post written by a user, anonymous or not.
+func (r *PostRepo) ListByUser(ctx context.Context, userID int) ([]*models.Post, error) {
+	rows, err := r.db.QueryContext(ctx, postSelect+` WHERE p.user_id=$1 ORDER BY p.id`, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var out []*models.Post
 	for rows.Next() {
-		var p models.Post
-		var createdAt, updatedAt sql.NullTime
-		if err := rows.Scan(&p.ID, &p.Title, &p.Description, &p.CompanyID, &p.UserID, &p.Likes, &createdAt, &updatedAt); err != nil {
+		p, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
-		if createdAt.Valid {
-			p.CreatedAt = createdAt.Time
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// LikesByUser returns the posts a user liked.
+func (r *PostRepo) LikesByUser(ctx context.Context, userID int) ([]*models.Like, error) {
+	return listLikes(ctx, r.db, `SELECT 'post', post_id, created_at FROM post_likes WHERE user_id=$1 ORDER BY created_at`, userID)
+}
+
+func listLikes(ctx context.Context, db *sql.DB, query string, userID int) ([]*models.Like, error) {
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Like
+	for rows.Next() {
+		var l models.Like
+		if err := rows.Scan(&l.TargetType, &l.TargetID, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &l)
+	}
+	return out, rows.Err()
+}
+
+// toggleLike inserts a like of target row targetID into table, or deletes it
+// when userID already liked it, and returns the new state with the target's
+// like count, which triggers on table keep current. ON CONFLICT makes
+// concurrent toggles by the same user queue up rather than fail.
+func toggleLike(ctx context.Context, db *sql.DB, target, table, column string, userID, targetID int) (bool, int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (user_id, `+column+`) VALUES ($1,$2) ON CONFLICT (user_id, `+column+`) DO NOTHING`, userID, targetID)
+	if isForeignKeyViolation(err) {
+		return false, 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, 0, err
+	}
+	liked := n == 1
+	if !liked {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id=$1 AND `+column+`=$2`, userID, targetID); err != nil {
+			return false, 0, err
 		}
-		if updatedAt.Valid {
-			p.UpdatedAt = updatedAt.Time
+	}
+	var likes int
+	if err := tx.QueryRowContext(ctx, `SELECT likes FROM `+target+` WHERE id=$1`, targetID).Scan(&likes); err != nil {
+		return false, 0, err
+	}
+	return liked, likes, tx.Commit()
+}
+
+func likedBy(ctx context.Context, db *sql.DB, query string, userID int, ids []int) (map[int]bool, error) {
+	liked := map[int]bool{}
+	if len(ids) == 0 {
+		return liked, nil
+	}
+	rows, err := db.QueryContext(ctx, query, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
-		out = append(out, &p)
+		liked[id] = true
+	}
+	return liked, rows.Err()
+}
+
+// reconcileLikes sets the likes column of target to the number of rows in
+// table referring to each row and returns how many rows it corrected. New
+// likes wait until it commits so none can be counted twice or missed.
+func reconcileLikes(ctx context.Context, db *sql.DB, target, table, column string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE `+table+` IN SHARE MODE`); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE `+target+` t SET likes = n.count
+		FROM (SELECT x.id, count(l.id) AS count FROM `+target+` x LEFT JOIN `+table+` l ON l.`+column+` = x.id GROUP BY x.id) n
+		WHERE n.id = t.id AND t.likes <> n.count`)
+	if err != nil {
+		return 0, err
+	}
+	fixed, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
-	return out, nil
+	return fixed, tx.Commit()
 }
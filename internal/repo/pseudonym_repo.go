@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// ErrPseudonymTaken is returned by Create when another user already holds the
+// name within the company.
+var ErrPseudonymTaken = errors.New("pseudonym taken")
+
+type PseudonymRepo struct{ db *sql.DB }
+
+func NewPseudonymRepo(db *sql.DB) *PseudonymRepo { return &PseudonymRepo{db: db} }
+
+func (r *PseudonymRepo) Get(ctx context.Context, userID, companyID int) (*models.Pseudonym, error) {
+	var p models.Pseudonym
+	err := r.db.QueryRowContext(ctx, `SELECT id, user_id, company_id, name, created_at FROM pseudonym WHERE user_id=$1 AND company_id=$2`, userID, companyID).Scan(&p.ID, &p.UserID, &p.CompanyID, &p.Name, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Create stores p unless the user already has a pseudonym for the company, in
+// which case p is filled in with the existing one.
+func (r *PseudonymRepo) Create(ctx context.Context, p *models.Pseudonym) error {
+	err := r.db.QueryRowContext(ctx, `INSERT INTO pseudonym (user_id, company_id, name) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id, company_id) DO NOTHING RETURNING id, created_at`, p.UserID, p.CompanyID, p.Name).Scan(&p.ID, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		existing, err := r.Get(ctx, p.UserID, p.CompanyID)
+		if err != nil {
+			return err
+		}
+		*p = *existing
+		return nil
+	}
+	if err != nil && isUniqueViolation(err) {
+		return ErrPseudonymTaken
+	}
+	return err
+}
+
+func (r *PseudonymRepo) LogDeanonymization(ctx context.Context, l *models.DeanonymizationLog) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO deanonymization_log (moderator_id, target_type, target_id, user_id, reason) VALUES ($1,$2,$3,$4,$5) RETURNING id, created_at`, l.ModeratorID, l.TargetType, l.TargetID, l.UserID, l.Reason).Scan(&l.ID, &l.CreatedAt)
+}
+
+var deanonymizationsNewest = keyset{name: "new", exprs: []string{`created_at`, `id`}, kinds: []keyKind{keyTime, keyInt}, desc: true}
+
+// ListDeanonymizations returns one page of the audit log, newest first.
+func (r *PseudonymRepo) ListDeanonymizations(ctx context.Context, p Page) ([]*models.DeanonymizationLog, string, error) {
+	q := pageQuery{columns: `id, moderator_id, target_type, target_id, user_id, reason, created_at`, from: `FROM deanonymization_log`}
+	return listPage(ctx, r.db, q, deanonymizationsNewest, p, func(row rowScanner) (*models.DeanonymizationLog, error) {
+		var l models.DeanonymizationLog
+		if err := row.Scan(&l.ID, &l.ModeratorID, &l.TargetType, &l.TargetID, &l.UserID, &l.Reason, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		return &l, nil
+	})
+}
@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+var ErrReviewExists = errors.New("you already reviewed this company this year")
+
+type ReviewRepo struct{ db *sql.DB }
+
+func NewReviewRepo(db *sql.DB) *ReviewRepo { return &ReviewRepo{db: db} }
+
+// ratingAggregates summarises the company_review rows aliased r; ratingColumns
+// names its outputs when joined as rs.
+const (
+	ratingAggregates = `count(*) AS count,
+	round(avg(r.overall), 2)::float8 AS overall,
+	round(avg(r.compensation), 2)::float8 AS compensation,
+	round(avg(r.work_life_balance), 2)::float8 AS work_life_balance,
+	round(avg(r.management), 2)::float8 AS management,
+	round(avg(r.culture), 2)::float8 AS culture,
+	round(avg(r.career_growth), 2)::float8 AS career_growth`
+	ratingColumns = `rs.count, rs.overall, rs.compensation, rs.work_life_balance, rs.management, rs.culture, rs.career_growth`
+)
+
+// reviewSelect lists review columns, the author's pseudonym for the company
+// and whether the author is a verified employee of it.
+const (
+	reviewColumns = `r.id, r.company_id, r.user_id,
+	CASE WHEN u.deleted_at IS NOT NULL THEN '[deleted user]' ELSE COALESCE(ps.name, 'Anonymous') END,
+	r.review_year, r.overall, r.compensation, r.work_life_balance, r.management, r.culture, r.career_growth,
+	r.pros, r.cons, r.job_title, r.employment_status, r.tenure_years,
+	EXISTS(SELECT 1 FROM user_company_affiliation a WHERE a.user_id = r.user_id AND a.company_id = r.company_id),
+	r.created_at, r.updated_at, u.deleted_at IS NOT NULL`
+	reviewFrom = `FROM company_review r
+	JOIN users u ON u.id = r.user_id
+	LEFT JOIN pseudonym ps ON ps.user_id = r.user_id AND ps.company_id = r.company_id`
+	reviewSelect = `SELECT ` + reviewColumns + ` ` + reviewFrom
+)
+
+func scanReview(row rowScanner) (*models.Review, error) {
+	var r models.Review
+	if err := row.Scan(&r.ID, &r.CompanyID, &r.UserID, &r.Author,
+		&r.Year, &r.Overall, &r.Compensation, &r.WorkLifeBalance, &r.Management, &r.Culture, &r.CareerGrowth,
+		&r.Pros, &r.Cons, &r.JobTitle, &r.EmploymentStatus, &r.TenureYears,
+		&r.VerifiedEmployee, &r.CreatedAt, &r.UpdatedAt, &r.AuthorDeleted); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Create stores a review, returning ErrReviewExists when the user already
+// reviewed the company this year.
+func (r *ReviewRepo) Create(ctx context.Context, rv *models.Review) error {
+	err := r.db.QueryRowContext(ctx, `INSERT INTO company_review (company_id, user_id, overall, compensation, work_life_balance, management, culture, career_growth, pros, cons, job_title, employment_status, tenure_years)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13) RETURNING id, review_year, created_at, updated_at`,
+		rv.CompanyID, rv.UserID, rv.Overall, rv.Compensation, rv.WorkLifeBalance, rv.Management, rv.Culture, rv.CareerGrowth,
+		rv.Pros, rv.Cons, rv.JobTitle, rv.EmploymentStatus, rv.TenureYears).Scan(&rv.ID, &rv.Year, &rv.CreatedAt, &rv.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrReviewExists
+	}
+	return err
+}
+
+func (r *ReviewRepo) GetByID(ctx context.Context, id int) (*models.Review, error) {
+	return scanReview(r.db.QueryRowContext(ctx, reviewSelect+` WHERE r.id=$1`, id))
+}
+
+// Update rewrites a review's scores and text. The company, author and year
+// never change.
+func (r *ReviewRepo) Update(ctx context.Context, rv *models.Review) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE company_review SET overall=$1, compensation=$2, work_life_balance=$3, management=$4, culture=$5, career_growth=$6,
+		pros=$7, cons=$8, job_title=$9, employment_status=$10, tenure_years=$11 WHERE id=$12`,
+		rv.Overall, rv.Compensation, rv.WorkLifeBalance, rv.Management, rv.Culture, rv.CareerGrowth,
+		rv.Pros, rv.Cons, rv.JobTitle, rv.EmploymentStatus, rv.TenureYears, rv.ID)
+	return err
+}
+
+func (r *ReviewRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM company_review WHERE id=$1`, id)
+	return err
+}
+
+var reviewsNewest = keyset{name: "new", exprs: []string{`r.created_at`, `r.id`}, kinds: []keyKind{keyTime, keyInt}, desc: true}
+
+// ListForCompany returns one page of a company's reviews, newest first.
+// includeSubsidiaries rolls up reviews of every company below it.
+func (r *ReviewRepo) ListForCompany(ctx context.Context, companyID int, includeSubsidiaries bool, p Page) ([]*models.Review, string, error) {
+	q := pageQuery{columns: reviewColumns, from: reviewFrom}
+	if includeSubsidiaries {
+		q.where = append(q.where, `r.company_id IN `+companySubtree(q.arg(companyID)))
+	} else {
+		q.where = append(q.where, `r.company_id = `+q.arg(companyID))
+	}
+	return listPage(ctx, r.db, q, reviewsNewest, p, scanReview)
+}
+
+// ListByUser returns every review a user wrote.
+func (r *ReviewRepo) ListByUser(ctx context.Context, userID int) ([]*models.Review, error) {
+	rows, err := r.db.QueryContext(ctx, reviewSelect+` WHERE r.user_id=$1 ORDER BY r.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Review
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rv)
+	}
+	return out, rows.Err()
+}
+
+// Summary aggregates a company's reviews, optionally together with those of
+// its subsidiaries.
+func (r *ReviewRepo) Summary(ctx context.Context, companyID int, includeSubsidiaries bool) (*models.RatingSummary, error) {
+	where := `r.company_id = $1`
+	if includeSubsidiaries {
+		where = `r.company_id IN ` + companySubtree(`$1`)
+	}
+	var s models.RatingSummary
+	err := r.db.QueryRowContext(ctx, `SELECT `+ratingAggregates+` FROM company_review r WHERE `+where, companyID).
+		Scan(&s.Count, &s.Overall, &s.Compensation, &s.WorkLifeBalance, &s.Management, &s.Culture, &s.CareerGrowth)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+type RoleRepo struct{ db *sql.DB }
+
+func NewRoleRepo(db *sql.DB) *RoleRepo { return &RoleRepo{db: db} }
+
+// SetUserRole changes a user's site-wide role.
+func (r *RoleRepo) SetUserRole(ctx context.Context, userID int, role string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET role=$1 WHERE id=$2`, role, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RoleRepo) GrantCompanyRole(ctx context.Context, cr *models.CompanyRole) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO company_role (user_id, company_id, role) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id, company_id, role) DO UPDATE SET role=EXCLUDED.role
+		RETURNING id, created_at`, cr.UserID, cr.CompanyID, cr.Role).Scan(&cr.ID, &cr.CreatedAt)
+}
+
+func (r *RoleRepo) RevokeCompanyRole(ctx context.Context, userID, companyID int, role string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM company_role WHERE user_id=$1 AND company_id=$2 AND role=$3`, userID, companyID, role)
+	return err
+}
+
+var companyRolesByID = keyset{name: "id", exprs: []string{`id`}, kinds: []keyKind{keyInt}}
+
+// ListCompanyRoles returns one page of the roles granted at a company.
+func (r *RoleRepo) ListCompanyRoles(ctx context.Context, companyID int, p Page) ([]*models.CompanyRole, string, error) {
+	q := pageQuery{columns: `id, user_id, company_id, role, created_at`, from: `FROM company_role`}
+	q.where = append(q.where, `company_id = `+q.arg(companyID))
+	return listPage(ctx, r.db, q, companyRolesByID, p, scanCompanyRole)
+}
+
+func (r *RoleRepo) CompanyRolesForUser(ctx context.Context, userID int) ([]*models.CompanyRole, error) {
+	return r.listCompanyRoles(ctx, `SELECT id, user_id, company_id, role, created_at FROM company_role WHERE user_id=$1 ORDER BY id`, userID)
+}
+
+func (r *RoleRepo) listCompanyRoles(ctx context.Context, query string, arg int) ([]*models.CompanyRole, error) {
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.CompanyRole
+	for rows.Next() {
+		cr, err := scanCompanyRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cr)
+	}
+	return out, rows.Err()
+}
+
+func scanCompanyRole(row rowScanner) (*models.CompanyRole, error) {
+	var cr models.CompanyRole
+	if err := row.Scan(&cr.ID, &cr.UserID, &cr.CompanyID, &cr.Role, &cr.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &cr, nil
+}
@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+// ErrEmptySearch is returned when a search query has no words to look for.
+var ErrEmptySearch = errors.New("search query has no words")
+
+// tsQuery turns a search box query into to_tsquery syntax. Words must all
+// match; "quoted words" must appear next to each other in order, a trailing *
+// matches any word with that prefix, a leading - excludes a word or phrase and
+// OR between two terms lets either match. Punctuation inside a word splits it
+// into a phrase, so no user input reaches to_tsquery as an operator.
+func tsQuery(s string) (string, error) {
+	// groups are ANDed together; the terms within each are ORed.
+	var groups [][]string
+	or := false
+	add := func(fields []string, negate bool) {
+		t := tsPhrase(fields)
+		if t == "" {
+			return
+		}
+		if negate {
+			t = "!" + t
+		}
+		if or {
+			groups[len(groups)-1] = append(groups[len(groups)-1], t)
+		} else {
+			groups = append(groups, []string{t})
+		}
+		or = false
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		negate := rs[i] == '-'
+		if negate {
+			i++
+		}
+		if i < len(rs) && rs[i] == '"' {
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' {
+				j++
+			}
+			add(strings.Fields(string(rs[i+1:j])), negate)
+			i = j + 1
+			continue
+		}
+		j := i
+		for j < len(rs) && !unicode.IsSpace(rs[j]) {
+			j++
+		}
+		w := string(rs[i:j])
+		i = j
+		if w == "OR" && !negate {
+			or = len(groups) > 0
+			continue
+		}
+		add([]string{w}, negate)
+	}
+	if len(groups) == 0 {
+		return "", ErrEmptySearch
+	}
+	and := make([]string, len(groups))
+	for i, g := range groups {
+		and[i] = strings.Join(g, " | ")
+		if len(g) > 1 && len(groups) > 1 {
+			and[i] = "(" + and[i] + ")"
+		}
+	}
+	return strings.Join(and, " & "), nil
+}
+
+// tsPhrase renders words as lexemes that must follow each other.
+func tsPhrase(fields []string) string {
+	var lexemes []string
+	for _, f := range fields {
+		prefix := strings.HasSuffix(f, "*")
+		parts := strings.FieldsFunc(f, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if len(parts) == 0 {
+			continue
+		}
+		if prefix {
+			parts[len(parts)-1] += ":*"
+		}
+		lexemes = append(lexemes, parts...)
+	}
+	switch len(lexemes) {
+	case 0:
+		return ""
+	case 1:
+		return lexemes[0]
+	}
+	return "(" + strings.Join(lexemes, " <-> ") + ")"
+}
+
+// SearchFilter narrows Search. Zero values are ignored.
+type SearchFilter struct {
+	PostFilter
+	Query string
+	// Industry matches the industry of the post's company, ignoring case.
+	Industry string
+	// After and Before bound the day the post was created, inclusive.
+	After  *time.Time
+	Before *time.Time
+}
+
+// htmlEscaped escapes the text expr so highlighted snippets are safe to
+// render as HTML.
+func htmlEscaped(expr string) string {
+	return `replace(replace(replace(` + expr + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+}
+
+const headlineOptions = `'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "'`
+
+var searchRelevance = keyset{name: "rank", exprs: []string{`r.rank`, `p.id`}, kinds: []keyKind{keyFloat, keyInt}, desc: true}
+
+// Search returns one page of the posts matching f, most relevant first. A
+// post matches on its title, its description or any of its comments, in
+// falling order of weight; a post's rank adds that of its best comment.
+func (r *PostRepo) Search(ctx context.Context, f SearchFilter, p Page) ([]*models.SearchResult, string, error) {
+	tsq, err := tsQuery(f.Query)
+	if err != nil {
+		return nil, "", err
+	}
+	q := pageQuery{}
+	query := `to_tsquery('english', ` + q.arg(tsq) + `)`
+	q.columns = postColumns + `,
+		r.rank, ts_headline('english', ` + htmlEscaped(`p.title || E'\n' || coalesce(p.description, '')`) + `, s.q, ` + headlineOptions + `),
+		bc.id, bc.snippet`
+	q.from = postFrom + `
+		CROSS JOIN LATERAL (SELECT ` + query + ` AS q) s
+		LEFT JOIN LATERAL (
+			SELECT c.id, ts_rank(c.search, s.q) AS rank,
+				ts_headline('english', ` + htmlEscaped(`c.message`) + `, s.q, ` + headlineOptions + `) AS snippet
+			FROM comment c WHERE c.post_id = p.id AND c.search @@ s.q
+			ORDER BY rank DESC, c.id LIMIT 1
+		) bc ON true
+		CROSS JOIN LATERAL (SELECT (ts_rank(p.search, s.q) + coalesce(bc.rank, 0))::float8 AS rank) r`
+	q.where = append(q.where, `p.id IN (SELECT id FROM post WHERE search @@ `+query+`
+		UNION SELECT post_id FROM comment WHERE search @@ `+query+`)`)
+	if f.CompanyID != 0 {
+		if f.IncludeSubsidiaries {
+			q.where = append(q.where, `p.company_id IN `+companySubtree(q.arg(f.CompanyID)))
+		} else {
+			q.where = append(q.where, `p.company_id = `+q.arg(f.CompanyID))
+		}
+	}
+	if f.Industry != "" {
+		q.where = append(q.where, `p.company_id IN (SELECT id FROM company WHERE lower(industry) = lower(`+q.arg(f.Industry)+`))`)
+	}
+	if f.After != nil {
+		q.where = append(q.where, `p.created_at >= `+q.arg(*f.After))
+	}
+	if f.Before != nil {
+		q.where = append(q.where, `p.created_at < `+q.arg(f.Before.AddDate(0, 0, 1)))
+	}
+	return listPage(ctx, r.db, q, searchRelevance, p, scanSearchResult)
+}
+
+func scanSearchResult(row rowScanner) (*models.SearchResult, error) {
+	var res models.SearchResult
+	var commentID *int
+	var commentSnippet *string
+	post, err := scanPost(keyScanner{row: row, keys: []interface{}{&res.Rank, &res.Snippet, &commentID, &commentSnippet}})
+	if err != nil {
+		return nil, err
+	}
+	res.Post = post
+	if commentID != nil && commentSnippet != nil {
+		res.Comment = &models.CommentSnippet{ID: *commentID, Snippet: *commentSnippet}
+	}
+	return &res, nil
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTSQuery(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"remote work", "remote & work"},
+		{`"remote work"`, "(remote <-> work)"},
+		{`"remote work`, "(remote <-> work)"},
+		{"-layoffs pay", "!layoffs & pay"},
+		{`-"bad manager" pay`, "!(bad <-> manager) & pay"},
+		{"remote OR hybrid", "remote | hybrid"},
+		{"pay remote OR hybrid", "pay & (remote | hybrid)"},
+		{"OR pay", "pay"},
+		{"pay OR", "pay"},
+		{"remote or hybrid", "remote & or & hybrid"},
+		{"-OR", "!OR"},
+		{"manag*", "manag:*"},
+		{`"senior eng*"`, "(senior <-> eng:*)"},
+		{"e-mail", "(e <-> mail)"},
+		{"c++ dev", "c & dev"},
+		{"foo:*|bar", "(foo <-> bar)"},
+		{"a&b !c", "(a <-> b) & c"},
+		{"Ärger über", "Ärger & über"},
+	} {
+		got, err := tsQuery(tt.in)
+		if err != nil {
+			t.Errorf("tsQuery(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("tsQuery(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTSQueryEmpty(t *testing.T) {
+	for _, in := range []string{"", "   ", "&|!", `"" - *`, "OR", `":*"`} {
+		if got, err := tsQuery(in); !errors.Is(err, ErrEmptySearch) {
+			t.Errorf("tsQuery(%q) = %q, %v; want ErrEmptySearch", in, got, err)
+		}
+	}
+}
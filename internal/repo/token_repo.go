@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/brennanromance/heard/internal/models"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+	ErrSessionRevoked       = errors.New("session revoked")
+)
+
+type TokenRepo struct{ db *sql.DB }
+
+func NewTokenRepo(db *sql.DB) *TokenRepo { return &TokenRepo{db: db} }
+
+// sessionTouchInterval bounds how often last_seen_at is written for an active
+// session.
+const sessionTouchInterval = time.Minute
+
+func (r *TokenRepo) CreateSession(ctx context.Context, s *models.Session) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO auth_session (id, user_id, user_agent, ip) VALUES ($1,$2,NULLIF($3,''),NULLIF($4,'')) RETURNING created_at, last_seen_at`, s.ID, s.UserID, s.UserAgent, s.IP).Scan(&s.CreatedAt, &s.LastSeenAt)
+}
+
+// TouchSession records activity on a session from ip.
+func (r *TokenRepo) TouchSession(ctx context.Context, sessionID, ip string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_session SET last_seen_at=now(), ip=NULLIF($2,'') WHERE id=$1 AND last_seen_at < $3`, sessionID, ip, time.Now().Add(-sessionTouchInterval))
+	return err
+}
+
+// ListActiveSessions returns the user's sessions that are neither revoked nor
+// expired, most recently used first.
+func (r *TokenRepo) ListActiveSessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT s.id, s.user_id, COALESCE(s.user_agent, ''), COALESCE(s.ip, ''), s.created_at, s.last_seen_at
+		FROM auth_session s
+		WHERE s.user_id=$1 AND s.revoked_at IS NULL
+		AND EXISTS(SELECT 1 FROM refresh_token rt WHERE rt.session_id = s.id AND rt.used_at IS NULL AND rt.expires_at > now())
+		ORDER BY s.last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*models.Session
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &s)
+	}
+	return out, rows.Err()
+}
+
+func (r *TokenRepo) CreateRefreshToken(ctx context.Context, t *models.RefreshToken, tokenHash string) error {
+	return r.db.QueryRowContext(ctx, `INSERT INTO refresh_token (session_id, user_id, token_hash, expires_at) VALUES ($1,$2,$3,$4) RETURNING id, created_at`, t.SessionID, t.UserID, tokenHash, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+}
+
+// RotateRefreshToken consumes the refresh token identified by oldHash and stores
+// next (hashed as newHash) in the same session. Presenting a token that was
+// already consumed is treated as theft: the whole session is revoked and
+// ErrRefreshTokenReused is returned.
+func (r *TokenRepo) RotateRefreshToken(ctx context.Context, oldHash string, next *models.RefreshToken, newHash, ip string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var cur models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT rt.id, rt.session_id, rt.user_id, rt.expires_at, rt.used_at, s.revoked_at
+		FROM refresh_token rt JOIN auth_session s ON s.id = rt.session_id
+		WHERE rt.token_hash=$1 FOR UPDATE OF rt, s`, oldHash).Scan(&cur.ID, &cur.SessionID, &cur.UserID, &cur.ExpiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if revokedAt.Valid {
+		return ErrSessionRevoked
+	}
+	if usedAt.Valid {
+		if _, err := tx.ExecContext(ctx, `UPDATE auth_session SET revoked_at=now() WHERE id=$1`, cur.SessionID); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+	if time.Now().After(cur.ExpiresAt) {
+		return ErrRefreshTokenExpired
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_token SET used_at=now() WHERE id=$1`, cur.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE auth_session SET last_seen_at=now(), ip=NULLIF($2,'') WHERE id=$1`, cur.SessionID, ip); err != nil {
+		return err
+	}
+	next.SessionID = cur.SessionID
+	next.UserID = cur.UserID
+	if err := tx.QueryRowContext(ctx, `INSERT INTO refresh_token (session_id, user_id, token_hash, expires_at) VALUES ($1,$2,$3,$4) RETURNING id, created_at`, next.SessionID, next.UserID, newHash, next.ExpiresAt).Scan(&next.ID, &next.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TokenRepo) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_session SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL`, sessionID)
+	return err
+}
+
+// RevokeUserSession revokes one of userID's sessions. It returns
+// sql.ErrNoRows when the user has no such active session.
+func (r *TokenRepo) RevokeUserSession(ctx context.Context, userID int, sessionID string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE auth_session SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *TokenRepo) RevokeAllSessions(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_session SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, userID)
+	return err
+}
+
+// RevokeOtherSessions signs the user out everywhere except keepID.
+func (r *TokenRepo) RevokeOtherSessions(ctx context.Context, userID int, keepID string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_session SET revoked_at=now() WHERE user_id=$1 AND id<>$2 AND revoked_at IS NULL`, userID, keepID)
+	return err
+}
+
+func (r *TokenRepo) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO revoked_token (jti, expires_at) VALUES ($1,$2) ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	return err
+}
+
+// IsRevoked reports whether an access token was revoked directly or belongs to
+// a revoked session.
+func (r *TokenRepo) IsRevoked(ctx context.Context, jti, sessionID string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM revoked_token WHERE jti=$1)
+		OR EXISTS(SELECT 1 FROM auth_session WHERE id=$2 AND revoked_at IS NOT NULL)`, jti, sessionID).Scan(&revoked)
+	return revoked, err
+}
+
+// PurgeExpired removes revocation entries and refresh tokens that can no
+// longer be presented.
+func (r *TokenRepo) PurgeExpired(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM revoked_token WHERE expires_at < now()`); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM refresh_token WHERE expires_at < now()`)
+	return err
+}
@@ -3,24 +3,35 @@ package repo
 import (
     "context"
     "database/sql"
+    "sync"
 
     "github.com/brennanromance/heard/internal/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type UserRepo struct{ db *sql.DB }
+type UserRepo struct {
+	db   *sql.DB
+	cost int
 
-func NewUserRepo(db *sql.DB) *UserRepo { return &UserRepo{db: db} }
+	dummyOnce sync.Once
+	dummyHash []byte
+}
+
+func NewUserRepo(db *sql.DB) *UserRepo { return &UserRepo{db: db, cost: bcrypt.DefaultCost} }
+
+// SetPasswordCost sets the bcrypt cost for new hashes. Existing hashes with a
+// lower cost are upgraded the next time the password is verified.
+func (r *UserRepo) SetPasswordCost(cost int) { r.cost = cost }
 
 func (r *UserRepo) Create(ctx context.Context, u *models.User) error {
 	// Hash password before storing
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), r.cost)
 	if err != nil {
 		return err
 	}
 
 	var id int
-	err = r.db.QueryRowContext(ctx, `INSERT INTO users (username, email, password) VALUES ($1,$2,$3) RETURNING id`, u.Username, u.Email, string(hashedPassword)).Scan(&id)
+	err = r.db.QueryRowContext(ctx, `INSERT INTO users (username, email, password) VALUES ($1,$2,$3) RETURNING id, role`, u.Username, u.Email, string(hashedPassword)).Scan(&id, &u.Role)
 	if err != nil {
 		return err
 	}
@@ -29,9 +40,26 @@ func (r *UserRepo) Create(ctx context.Context, u *models.User) error {
 	return nil
 }
 
+// CreateServiceAccount creates a user that cannot sign in with a password and
+// only acts through API keys.
+func (r *UserRepo) CreateServiceAccount(ctx context.Context, u *models.User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), r.cost)
+	if err != nil {
+		return err
+	}
+	return r.db.QueryRowContext(ctx, `INSERT INTO users (username, email, password, service_account) VALUES ($1,$2,$3,true) RETURNING id, role`, u.Username, u.Email, string(hashedPassword)).Scan(&u.ID, &u.Role)
+}
+
+// IsServiceAccount reports whether the user was created as a service account.
+func (r *UserRepo) IsServiceAccount(ctx context.Context, id int) (bool, error) {
+	var sa bool
+	err := r.db.QueryRowContext(ctx, `SELECT service_account FROM users WHERE id=$1 AND deleted_at IS NULL`, id).Scan(&sa)
+	return sa, err
+}
+
 func (r *UserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
 	var u models.User
-	err := r.db.QueryRowContext(ctx, `SELECT id, username, email, password FROM users WHERE id=$1`, id).Scan(&u.ID, &u.Username, &u.Email, &u.Password)
+	err := r.db.QueryRowContext(ctx, `SELECT id, username, email, password, role, email_verified, totp_enabled FROM users WHERE id=$1`, id).Scan(&u.ID, &u.Username, &u.Email, &u.Password, &u.Role, &u.EmailVerified, &u.MFAEnabled)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +68,7 @@ func (r *UserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
 
 func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	var u models.User
-	err := r.db.QueryRowContext(ctx, `SELECT id, username, email, password FROM users WHERE username=$1`, username).Scan(&u.ID, &u.Username, &u.Email, &u.Password)
+	err := r.db.QueryRowContext(ctx, `SELECT id, username, email, password, role, email_verified, totp_enabled FROM users WHERE username=$1 AND deleted_at IS NULL`, username).Scan(&u.ID, &u.Username, &u.Email, &u.Password, &u.Role, &u.EmailVerified, &u.MFAEnabled)
 	if err != nil {
 		return nil, err
 	}
@@ -49,26 +77,64 @@ func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*models.
 
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var u models.User
-	err := r.db.QueryRowContext(ctx, `SELECT id, username, email, password FROM users WHERE email=$1`, email).Scan(&u.ID, &u.Username, &u.Email, &u.Password)
+	err := r.db.QueryRowContext(ctx, `SELECT id, username, email, password, role, email_verified, totp_enabled FROM users WHERE email=$1 AND deleted_at IS NULL`, email).Scan(&u.ID, &u.Username, &u.Email, &u.Password, &u.Role, &u.EmailVerified, &u.MFAEnabled)
 	if err != nil {
 		return nil, err
 	}
 	return &u, nil
 }
 
-// VerifyPassword checks if the provided password matches the hashed password
+// RejectPassword takes as long as VerifyPassword does for a wrong password. Logins
+// for unknown emails call it so response times don't reveal which accounts exist.
+func (r *UserRepo) RejectPassword(password string) {
+	r.dummyOnce.Do(func() {
+		r.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("no account has this password"), r.cost)
+	})
+	bcrypt.CompareHashAndPassword(r.dummyHash, []byte(password))
+}
+
+// VerifyPassword checks if the provided password matches the hashed password,
+// upgrading the hash when it was made with a lower cost than configured
 func (r *UserRepo) VerifyPassword(ctx context.Context, userID int, password string) error {
 	var hashedPassword string
 	err := r.db.QueryRowContext(ctx, `SELECT password FROM users WHERE id=$1`, userID).Scan(&hashedPassword)
 	if err != nil {
 		return err
 	}
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+		return err
+	}
+	// Rehash with the configured cost while the plaintext is at hand
+	if cost, err := bcrypt.Cost([]byte(hashedPassword)); err == nil && cost < r.cost {
+		upgraded, err := bcrypt.GenerateFromPassword([]byte(password), r.cost)
+		if err != nil {
+			return err
+		}
+		_, err = r.db.ExecContext(ctx, `UPDATE users SET password=$1 WHERE id=$2 AND password=$3`, string(upgraded), userID, hashedPassword)
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET email_verified=true WHERE id=$1`, id)
+	return err
+}
+
+// SetPassword hashes password and stores it for the user.
+func (r *UserRepo) SetPassword(ctx context.Context, id int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), r.cost)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE users SET password=$1 WHERE id=$2`, string(hashedPassword), id)
+	return err
 }
 
+// Update saves the username and email. Changing the email clears
+// email_verified; passwords are only changed through SetPassword.
 func (r *UserRepo) Update(ctx context.Context, u *models.User) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE users SET username=$1, email=$2, password=$3 WHERE id=$4`, u.Username, u.Email, u.Password, u.ID)
-	return err
+	return r.db.QueryRowContext(ctx, `UPDATE users SET username=$1, email=$2, email_verified = email_verified AND email=$2 WHERE id=$3 RETURNING email_verified`, u.Username, u.Email, u.ID).Scan(&u.EmailVerified)
 }
 
 func (r *UserRepo) Delete(ctx context.Context, id int) error {
@@ -76,19 +142,17 @@ func (r *UserRepo) Delete(ctx context.Context, id int) error {
 	return err
 }
 
-func (r *UserRepo) List(ctx context.Context) ([]*models.User, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, username, email, password FROM users ORDER BY id`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var out []*models.User
-	for rows.Next() {
+var usersByID = keyset{name: "id", exprs: []string{`id`}, kinds: []keyKind{keyInt}}
+
+// List returns one page of active accounts in signup order. Password hashes
+// are not loaded.
+func (r *UserRepo) List(ctx context.Context, p Page) ([]*models.User, string, error) {
+	q := pageQuery{columns: `id, username, email, role, email_verified, totp_enabled`, from: `FROM users`, where: []string{`deleted_at IS NULL`}}
+	return listPage(ctx, r.db, q, usersByID, p, func(row rowScanner) (*models.User, error) {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Password); err != nil {
+		if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.EmailVerified, &u.MFAEnabled); err != nil {
 			return nil, err
 		}
-		out = append(out, &u)
-	}
-	return out, nil
-}
\ No newline at end of file
+		return &u, nil
+	})
+}
@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrUserTokenInvalid is returned when a token is unknown, expired or was
+// already used.
+var ErrUserTokenInvalid = errors.New("invalid or expired token")
+
+// UserTokenRepo stores the single-use tokens mailed to users.
+type UserTokenRepo struct{ db *sql.DB }
+
+func NewUserTokenRepo(db *sql.DB) *UserTokenRepo { return &UserTokenRepo{db: db} }
+
+// Create stores a new token for purpose and invalidates any earlier unused
+// ones for the same user and purpose.
+func (r *UserTokenRepo) Create(ctx context.Context, userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE user_token SET used_at=now() WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL`, userID, purpose); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO user_token (user_id, purpose, token_hash, expires_at) VALUES ($1,$2,$3,$4)`, userID, purpose, tokenHash, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Revoke invalidates every unused token of the user for purpose.
+func (r *UserTokenRepo) Revoke(ctx context.Context, userID int, purpose string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE user_token SET used_at=now() WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL`, userID, purpose)
+	return err
+}
+
+// Lookup returns the user a valid token was issued to without using it up.
+func (r *UserTokenRepo) Lookup(ctx context.Context, purpose, tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, `SELECT user_id FROM user_token
+		WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > now()`, tokenHash, purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserTokenInvalid
+	}
+	return userID, err
+}
+
+// Consume marks the token as used and returns the user it was issued to.
+func (r *UserTokenRepo) Consume(ctx context.Context, purpose, tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, `UPDATE user_token SET used_at=now()
+		WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id`, tokenHash, purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserTokenInvalid
+	}
+	return userID, err
+}
@@ -0,0 +1,54 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process. Records untouched for longer than
+// ttl are dropped.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	ttl     time.Duration
+	writes  int
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}, ttl: ttl}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, fn func(*Record)) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.records[key]
+	fn(&rec)
+	s.records[key] = rec
+	s.writes++
+	if s.writes%1000 == 0 {
+		s.prune(time.Now())
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	for k, r := range s.records {
+		if now.Sub(r.LastFailure) > s.ttl && !r.LockedUntil.After(now) {
+			delete(s.records, k)
+		}
+	}
+}
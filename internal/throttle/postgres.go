@@ -0,0 +1,68 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps records in the login_attempt table so that every API
+// instance sees the same counts.
+type PostgresStore struct{ db *sql.DB }
+
+func NewPostgresStore(db *sql.DB) *PostgresStore { return &PostgresStore{db: db} }
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	var rec Record
+	var last, locked sql.NullTime
+	err := s.db.QueryRowContext(ctx, `SELECT failures, last_failure, locked_until FROM login_attempt WHERE key=$1`, key).Scan(&rec.Failures, &last, &locked)
+	if err == sql.ErrNoRows {
+		return Record{}, nil
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	rec.LastFailure, rec.LockedUntil = last.Time, locked.Time
+	return rec, nil
+}
+
+func (s *PostgresStore) Update(ctx context.Context, key string, fn func(*Record)) (Record, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Record{}, err
+	}
+	defer tx.Rollback()
+
+	// Make sure a row exists so it can be locked for the read-modify-write
+	if _, err := tx.ExecContext(ctx, `INSERT INTO login_attempt (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`, key); err != nil {
+		return Record{}, err
+	}
+	var rec Record
+	var last, locked sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT failures, last_failure, locked_until FROM login_attempt WHERE key=$1 FOR UPDATE`, key).Scan(&rec.Failures, &last, &locked); err != nil {
+		return Record{}, err
+	}
+	rec.LastFailure, rec.LockedUntil = last.Time, locked.Time
+	fn(&rec)
+	if _, err := tx.ExecContext(ctx, `UPDATE login_attempt SET failures=$1, last_failure=$2, locked_until=$3 WHERE key=$4`,
+		rec.Failures, nullTime(rec.LastFailure), nullTime(rec.LockedUntil), key); err != nil {
+		return Record{}, err
+	}
+	return rec, tx.Commit()
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempt WHERE key=$1`, key)
+	return err
+}
+
+// Prune removes records whose last failure is older than ttl and that are no
+// longer locked.
+func (s *PostgresStore) Prune(ctx context.Context, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempt WHERE last_failure < $1 AND (locked_until IS NULL OR locked_until < now())`, time.Now().Add(-ttl))
+	return err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
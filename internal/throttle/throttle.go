@@ -0,0 +1,98 @@
+// Package throttle tracks failed attempts per key (an account, an IP address)
+// and locks keys out with exponential backoff.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Record is the persisted state for one key.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists records. Update must apply fn atomically so that concurrent
+// API instances sharing a store don't lose failures.
+type Store interface {
+	Get(ctx context.Context, key string) (Record, error)
+	Update(ctx context.Context, key string, fn func(*Record)) (Record, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Policy controls when and for how long a key is locked.
+type Policy struct {
+	// FreeAttempts failures are allowed before the first lockout.
+	FreeAttempts int
+	// BaseLockout is the first lockout; each further failure doubles it.
+	BaseLockout time.Duration
+	// MaxLockout caps the lockout duration.
+	MaxLockout time.Duration
+	// Window is how long after the last failure the count is forgotten.
+	Window time.Duration
+}
+
+// Throttler applies a Policy to keys held in a Store.
+type Throttler struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func New(store Store, policy Policy) *Throttler {
+	return &Throttler{store: store, policy: policy, now: time.Now}
+}
+
+// Check returns how long key remains locked, or zero when it isn't.
+func (t *Throttler) Check(ctx context.Context, key string) (time.Duration, error) {
+	rec, err := t.store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return remaining(rec.LockedUntil, t.now()), nil
+}
+
+// Fail records a failed attempt for key and returns the resulting lockout, if
+// any.
+func (t *Throttler) Fail(ctx context.Context, key string) (time.Duration, error) {
+	now := t.now()
+	rec, err := t.store.Update(ctx, key, func(r *Record) {
+		if !r.LastFailure.IsZero() && now.Sub(r.LastFailure) > t.policy.Window {
+			*r = Record{}
+		}
+		r.Failures++
+		r.LastFailure = now
+		if over := r.Failures - t.policy.FreeAttempts; over > 0 {
+			r.LockedUntil = now.Add(t.lockout(over))
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return remaining(rec.LockedUntil, now), nil
+}
+
+// Reset forgets every failure recorded for key.
+func (t *Throttler) Reset(ctx context.Context, key string) error {
+	return t.store.Delete(ctx, key)
+}
+
+func (t *Throttler) lockout(over int) time.Duration {
+	d := t.policy.BaseLockout
+	for i := 1; i < over && d < t.policy.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > t.policy.MaxLockout {
+		d = t.policy.MaxLockout
+	}
+	return d
+}
+
+func remaining(until, now time.Time) time.Duration {
+	if until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
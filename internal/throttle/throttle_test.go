@@ -0,0 +1,121 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{FreeAttempts: 3, BaseLockout: 30 * time.Second, MaxLockout: 5 * time.Minute, Window: time.Hour}
+
+// newTestThrottler returns a throttler on a memory store whose clock only
+// moves when the returned function is called.
+func newTestThrottler() (*Throttler, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	t := New(NewMemoryStore(time.Hour), testPolicy)
+	t.now = func() time.Time { return now }
+	return t, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestFailBackoff(t *testing.T) {
+	th, _ := newTestThrottler()
+	ctx := context.Background()
+	for i, want := range []time.Duration{
+		0, 0, 0, // free attempts
+		30 * time.Second,
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		5 * time.Minute, // capped
+		5 * time.Minute,
+	} {
+		got, err := th.Fail(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("failure %d: lockout %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestCheckUnlocksWhenLockoutEnds(t *testing.T) {
+	th, advance := newTestThrottler()
+	ctx := context.Background()
+	for i := 0; i < testPolicy.FreeAttempts+1; i++ {
+		if _, err := th.Fail(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, step := range []struct {
+		advance time.Duration
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{10 * time.Second, 20 * time.Second},
+		{20 * time.Second, 0},
+	} {
+		advance(step.advance)
+		got, err := th.Check(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != step.want {
+			t.Errorf("Check = %v, want %v", got, step.want)
+		}
+	}
+	// The failures still count: the next one doubles the lockout.
+	got, err := th.Fail(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != time.Minute {
+		t.Errorf("lockout after expiry = %v, want 1m", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	th, _ := newTestThrottler()
+	ctx := context.Background()
+	for i := 0; i < testPolicy.FreeAttempts+2; i++ {
+		if _, err := th.Fail(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := th.Reset(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := th.Check(ctx, "k"); err != nil || got != 0 {
+		t.Fatalf("Check after Reset = %v, %v", got, err)
+	}
+	if got, err := th.Fail(ctx, "k"); err != nil || got != 0 {
+		t.Errorf("first failure after Reset locked for %v, %v", got, err)
+	}
+}
+
+func TestWindowForgetsFailures(t *testing.T) {
+	th, advance := newTestThrottler()
+	ctx := context.Background()
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		if _, err := th.Fail(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	advance(testPolicy.Window + time.Second)
+	if got, err := th.Fail(ctx, "k"); err != nil || got != 0 {
+		t.Errorf("failure after the window locked for %v, %v", got, err)
+	}
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	th, _ := newTestThrottler()
+	ctx := context.Background()
+	for i := 0; i < testPolicy.FreeAttempts+1; i++ {
+		if _, err := th.Fail(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := th.Check(ctx, "b"); err != nil || got != 0 {
+		t.Errorf("Check(b) = %v, %v", got, err)
+	}
+}